@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+// controlSocket returns the socket given with -socket, or the one of the
+// current directory.
+func controlSocket(socket string) (string, error) {
+	if socket != "" {
+		return socket, nil
+	}
+	return pkg.ControlSocketPath(".")
+}
+
+// controlRequest sends a request to the running instance and decodes its
+// JSON answer into v.
+func controlRequest(socket, method, path string, body interface{}, v interface{}) error {
+	socket, err := controlSocket(socket)
+	if err != nil {
+		return err
+	}
+
+	data := []byte{}
+	if body != nil {
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, pkg.ControlURL+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	resp, err := pkg.NewControlClient(socket).Do(req)
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Errorf("watchngo is not running here, nothing listens on %s", socket)
+	} else if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var apiErr struct{ Error string }
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Error == "" {
+			return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+		}
+		return errors.New(apiErr.Error)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// lsCommand lists the watchers of the running instance.
+func lsCommand(args []string) error {
+	flags := flag.NewFlagSet("ls", flag.ExitOnError)
+	flagSocket := flags.String("socket", "", "control socket path")
+	_ = flags.Parse(args)
+
+	var infos []pkg.WatcherInfo
+	if err := controlRequest(*flagSocket, http.MethodGet, "/watchers", nil, &infos); err != nil {
+		return err
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(out, "WATCHER\tSTATE\tLOCATIONS\tLAST RUN\tEXIT\tDURATION")
+	for _, info := range infos {
+		if info.LastRun == nil {
+			fmt.Fprintf(out, "%s\t%s\t%d\t-\t-\t-\n", info.Name, info.State, info.Locations)
+			continue
+		}
+		fmt.Fprintf(out, "%s\t%s\t%d\t%s\t%d\t%s\n", info.Name, info.State, info.Locations, info.LastRun.Start.Format("2006/01/02 15:04:05"), info.LastRun.ExitCode, info.LastRun.Duration.Round(time.Millisecond))
+	}
+
+	return out.Flush()
+}
+
+// watcherCommand returns the trigger, pause or resume command.
+func watcherCommand(action string) func(args []string) error {
+	return func(args []string) error {
+		flags := flag.NewFlagSet(action, flag.ExitOnError)
+		flagSocket := flags.String("socket", "", "control socket path")
+		flagWait := true
+		if action == "trigger" {
+			flags.BoolVar(&flagWait, "wait", true, "wait for the run to finish, and fail if it failed")
+		}
+		_ = flags.Parse(args)
+
+		if flags.NArg() < 1 || action != "trigger" && flags.NArg() > 1 {
+			return fmt.Errorf("usage: watchngo %s <watcher>", action)
+		}
+
+		path := "/watchers/" + url.PathEscape(flags.Arg(0)) + "/" + action
+		var body interface{}
+		if action == "trigger" {
+			body = pkg.TriggerRequest{Paths: flags.Args()[1:]}
+			if flagWait {
+				path += "?wait=true"
+			}
+		}
+
+		var info pkg.WatcherInfo
+		if err := controlRequest(*flagSocket, http.MethodPost, path, body, &info); err != nil {
+			return err
+		}
+
+		if action != "trigger" || !flagWait {
+			fmt.Printf("%s: %s\n", info.Name, info.State)
+			return nil
+		}
+
+		run := info.LastRun
+		fmt.Printf("%s: run #%d exit %d in %s\n", info.Name, run.ID, run.ExitCode, run.Duration.Round(time.Millisecond))
+		if run.Error != "" {
+			return fmt.Errorf("%s: %s", info.Name, run.Error)
+		}
+
+		return nil
+	}
+}
+
+// reloadCommand replaces the watchers of the running instance from its
+// configuration.
+func reloadCommand(args []string) error {
+	flags := flag.NewFlagSet("reload", flag.ExitOnError)
+	flagSocket := flags.String("socket", "", "control socket path")
+	_ = flags.Parse(args)
+
+	var infos []pkg.WatcherInfo
+	if err := controlRequest(*flagSocket, http.MethodPost, "/reload", nil, &infos); err != nil {
+		return err
+	}
+
+	fmt.Printf("reloaded %d watchers\n", len(infos))
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+// statusCommand prints the state of each watcher from the status file.
+func statusCommand(args []string) error {
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	flagStateDir := flags.String("state_dir", pkg.DefaultStateDir, "directory holding the run history and status files")
+	flagJSON := flags.Bool("json", false, "print the status file")
+	_ = flags.Parse(args)
+
+	path := filepath.Join(*flagStateDir, pkg.StatusFile)
+	status, err := pkg.ReadStatus(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("status: watchngo is not running here, no %s", path)
+	} else if err != nil {
+		return err
+	}
+
+	alive := processAlive(status.PID)
+
+	if *flagJSON {
+		return json.NewEncoder(os.Stdout).Encode(status)
+	}
+
+	if !alive {
+		fmt.Printf("watchngo is not running, pid %d exited, last update %s\n", status.PID, status.Updated.Format(time.RFC3339))
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(out, "WATCHER\tSTATE\tLAST RUN\tEXIT\tDURATION")
+	for _, w := range status.Watchers {
+		if w.LastRun == nil {
+			fmt.Fprintf(out, "%s\t%s\t-\t-\t-\n", w.Name, w.State)
+			continue
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\t%d\t%s\n", w.Name, w.State, w.LastRun.Start.Format("2006/01/02 15:04:05"), w.LastRun.ExitCode, w.LastRun.Duration.Round(time.Millisecond))
+	}
+
+	return out.Flush()
+}
+
+// historyCommand prints the last runs from the history file.
+func historyCommand(args []string) error {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	flagStateDir := flags.String("state_dir", pkg.DefaultStateDir, "directory holding the run history and status files")
+	flagLast := flags.Int("n", 20, "number of runs to show")
+	flagWatcher := flags.String("watcher", "", "only show runs of this watcher")
+	flagOutput := flags.Bool("output", false, "show the end of the output of each run")
+	flagJSON := flags.Bool("json", false, "print runs as JSON lines")
+	_ = flags.Parse(args)
+
+	records, err := pkg.ReadHistory(filepath.Join(*flagStateDir, pkg.HistoryFile), 0)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if *flagWatcher != "" {
+		filtered := records[:0]
+		for _, r := range records {
+			if r.Watcher == *flagWatcher {
+				filtered = append(filtered, r)
+			}
+		}
+		records = filtered
+	}
+
+	if *flagLast > 0 && len(records) > *flagLast {
+		records = records[len(records)-*flagLast:]
+	}
+
+	if *flagJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, r := range records {
+		fmt.Printf("#%d %s %s exit %d in %s, %s\n", r.ID, r.Start.Format("2006/01/02 15:04:05"), r.Watcher, r.ExitCode, r.Duration.Round(time.Millisecond), describeCause(r))
+		if r.Error != "" {
+			fmt.Printf("    error: %s\n", r.Error)
+		}
+		if *flagOutput && r.Output != "" {
+			for _, line := range strings.Split(strings.TrimRight(r.Output, "\n"), "\n") {
+				fmt.Printf("    | %s\n", line)
+			}
+		}
+	}
+
+	return nil
+}
+
+// processAlive tells whether the process exists, even if not ours.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+func describeCause(r pkg.RunRecord) string {
+	switch {
+	case r.Cause == pkg.CauseEvents && len(r.Events) == 1:
+		return fmt.Sprintf("%s %s", r.Events[0].Op, r.Events[0].Path)
+	case r.Cause == pkg.CauseEvents && len(r.Events) > 1:
+		return fmt.Sprintf("%s %s and %d more changes", r.Events[0].Op, r.Events[0].Path, len(r.Events)-1)
+	case r.Cause == pkg.CauseEvents:
+		return "file changes"
+	case r.Cause == pkg.CauseManual:
+		return "triggered manually"
+	case r.Cause == pkg.CauseStart:
+		return "started"
+	case r.Cause == pkg.CauseRestart:
+		return "restarted after a crash"
+	case strings.HasPrefix(r.Cause, pkg.CauseWatcher):
+		return "triggered by " + strings.TrimPrefix(r.Cause, pkg.CauseWatcher)
+	default:
+		return r.Cause
+	}
+}
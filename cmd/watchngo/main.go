@@ -1,8 +1,13 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/Leryan/watchngo/pkg"
 	"github.com/go-ini/ini"
@@ -10,41 +15,332 @@ import (
 	"flag"
 )
 
+const usage = `usage: %[1]s [flags]
+       %[1]s status [-json]
+       %[1]s history [-n 20] [-watcher name] [-output] [-json]
+       %[1]s ls|reload
+       %[1]s trigger <watcher> [path...]
+       %[1]s pause|resume <watcher>
+`
+
 func main() {
+	pkg.RunLimitsHelper()
+
+	if len(os.Args) > 1 {
+		var command func([]string) error
+		switch os.Args[1] {
+		case "status":
+			command = statusCommand
+		case "history":
+			command = historyCommand
+		case "ls":
+			command = lsCommand
+		case "trigger", "pause", "resume":
+			command = watcherCommand(os.Args[1])
+		case "reload":
+			command = reloadCommand
+		}
+
+		if command != nil {
+			if err := command(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
 	flagConf := flag.String("conf", "watchngo.ini", "configuration file path")
 	flagMatch := flag.String(pkg.CfgMatch, "", "file or directory to watch. defaults to current directory")
 	flagFilter := flag.String(pkg.CfgFilter, "", "filter as a regex supported by golang")
 	flagCommand := flag.String(pkg.CfgCommand, "", "command to run. see configuration example for supported variables")
-	flagExecutor := flag.String(pkg.CfgExecutor, pkg.ExecutorUnixShell, "executors: unixshell, raw, stdout")
+	flagExecutor := flag.String(pkg.CfgExecutor, pkg.ExecutorUnixShell, "executors: unixshell, raw, stdout, pty")
+	flagMode := flag.String(pkg.CfgMode, pkg.ModeCommand, "modes: command, service to keep the command running and restart it on changes")
+	flagWorkDir := flag.String(pkg.CfgWorkDir, "", "directory to run the command in. defaults to current directory")
+	flagShell := flag.String(pkg.CfgShell, pkg.DefaultShell, "shell used by the unixshell executor")
+	flagShellArgs := flag.String(pkg.CfgShellArgs, pkg.DefaultShellArgs, "shell arguments, the command is given after them")
+	flagTimeout := flag.Duration(pkg.CfgTimeout, 0, "stop the command when it runs for longer. 0 to disable")
+	flagKillGrace := flag.Duration(pkg.CfgKillGrace, pkg.DefaultKillGrace, "delay between SIGTERM and SIGKILL on timeout")
+	flagRetries := flag.Int(pkg.CfgRetries, 0, "number of times a failed command is run again")
+	flagRetryBackoff := flag.String(pkg.CfgRetryBackoff, "1s..30s", "delay between retries, doubling from min to max: min..max")
+	flagBreaker := flag.Int(pkg.CfgBreaker, 0, "pause after this number of consecutive failed runs. 0 to disable")
+	flagOnStart := flag.String(pkg.CfgOnStart, "", "command to run before the command")
+	flagOnSuccess := flag.String(pkg.CfgOnSuccess, "", "command to run when the command succeeded")
+	flagOnFailure := flag.String(pkg.CfgOnFailure, "", "command to run when the command failed")
+	flagOutput := flag.String(pkg.CfgOutput, pkg.OutputStream, "output modes: stream, on-failure, diff")
+	flagProblemMatcher := flag.String(pkg.CfgProblemMatcher, "", "write diagnostics found in the output to quickfix and JSON files: go, gcc, eslint or a regexp")
+	flagClear := flag.Bool(pkg.CfgClear, false, "clear the terminal before each run")
+	flagBanner := flag.Bool(pkg.CfgBanner, false, "print a banner before and after each run")
+	flagTitle := flag.Bool(pkg.CfgTitle, false, "set the terminal title to the command status")
+	flagBell := flag.Bool(pkg.CfgBell, false, "ring the terminal bell when the command fails")
 	flagDebug := flag.Bool(pkg.CfgDebug, false, "debug")
 	flagSilent := flag.Bool(pkg.CfgSilent, false, "silence any output originating from watchngo. overrides -debug.")
+	flagLogFormat := flag.String("log-format", pkg.LogFormatText, "log formats: text, json, logfmt")
+	flagLogSink := flag.String("log-sink", "stderr", "log sinks: stderr, journald[:<socket>], syslog[:unix://<socket>|udp://<host:port>]")
+	flagLogOutput := flag.Bool(pkg.CfgLogOutput, false, "send the output of commands to the log sink")
+	flagLogLevel := flag.String("log-level", "", "log levels: error, warn, info, debug, trace. overrides -debug")
+	flagHistory := flag.Bool("history", true, "record runs and the state of watchers in the state directory")
+	flagStateDir := flag.String("state_dir", pkg.DefaultStateDir, "directory holding the run history and status files")
+	flagListen := flag.String("listen", "", "serve the HTTP API on this address, like 127.0.0.1:7777")
+	flagMetrics := flag.String("metrics", "", "serve Prometheus metrics on this address at /metrics, like 127.0.0.1:9177")
+	flagUI := flag.String("ui", "", "serve the web dashboard on this address, like 127.0.0.1:7778")
+	flagControl := flag.Bool("control", true, "open the control socket used by the ls, trigger, pause, resume and reload commands")
+	flagSocket := flag.String("socket", "", "control socket path. defaults to $XDG_RUNTIME_DIR/watchngo-<hash of the current directory>.sock, or below $TMPDIR/watchngo-<uid>")
+	flagKeys := flag.Bool("keys", true, "read keys typed in the terminal to re-run, pause or list watchers. h for help")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), usage, os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
-	var cfg *ini.File
+	var cliCfg *ini.File
 	if *flagCommand != "" {
-		cfg = pkg.BuildIniCfgFrom(pkg.Cfg{
+		minBackoff, maxBackoff, err := pkg.ParseBackoff(*flagRetryBackoff)
+		if err != nil {
+			log.Fatalf("conf: %v", err)
+		}
+
+		cliCfg = pkg.BuildIniCfgFrom(pkg.Cfg{
 			Name:            "cli",
 			Match:           *flagMatch,
 			Filter:          *flagFilter,
 			CommandTemplate: *flagCommand,
 			ExecutorName:    *flagExecutor,
-			Debug:           *flagDebug,
-			Silent:          *flagSilent,
+			Mode:            *flagMode,
+			WorkDir:         *flagWorkDir,
+			Shell:           *flagShell,
+			ShellArgs:       *flagShellArgs,
+			Timeout:         *flagTimeout,
+			KillGrace:       *flagKillGrace,
+			Retry: pkg.RetryPolicy{
+				Retries:    *flagRetries,
+				MinBackoff: minBackoff,
+				MaxBackoff: maxBackoff,
+			},
+			Breaker: *flagBreaker,
+			Hooks: pkg.Hooks{
+				OnStart:   *flagOnStart,
+				OnSuccess: *flagOnSuccess,
+				OnFailure: *flagOnFailure,
+			},
+			OutputMode:     *flagOutput,
+			ProblemMatcher: *flagProblemMatcher,
+			Presenter: pkg.Presenter{
+				Clear:  *flagClear,
+				Banner: *flagBanner,
+				Title:  *flagTitle,
+				Bell:   *flagBell,
+			},
+			Debug:     *flagDebug,
+			LogLevel:  *flagLogLevel,
+			LogOutput: *flagLogOutput,
+			Silent:    *flagSilent,
 		})
-	} else {
-		var err error
-		if cfg, err = ini.Load(*flagConf); err != nil {
-			log.Fatalf("conf: from path: %s: %v", *flagConf, err)
+	}
+
+	// the configuration file is read again on reloads.
+	loadConf := func() (*ini.File, error) {
+		if cliCfg != nil {
+			return cliCfg, nil
+		}
+
+		cfg, err := ini.Load(*flagConf)
+		if err != nil {
+			return nil, fmt.Errorf("conf: from path: %s: %w", *flagConf, err)
 		}
+
+		if defaults := cfg.Section(""); *flagLogLevel != "" && !defaults.HasKey(pkg.CfgLogLevel) {
+			defaults.Key(pkg.CfgLogLevel).SetValue(*flagLogLevel)
+		}
+
+		return cfg, nil
 	}
 
-	logger := log.New(os.Stderr, "", log.LstdFlags)
+	// levels are filtered by each watcher.
+	logger, err := pkg.OpenLogSink(*flagLogSink, *flagLogFormat, pkg.LevelTrace)
+	if err != nil {
+		log.Fatalf("conf: %v", err)
+	}
 	log.SetOutput(os.Stderr)
 
-	watchers, err := pkg.WatchersFromConf(cfg, logger, pkg.ExecutorFromName)
+	// logs of watchngo itself, the ones of watchers are filtered by each.
+	level := pkg.LevelInfo
+	if *flagDebug {
+		level = pkg.LevelDebug
+	}
+	if *flagLogLevel != "" {
+		if level, err = pkg.ParseLevel(*flagLogLevel); err != nil {
+			log.Fatalf("conf: %v", err)
+		}
+	}
+	mainLogger := pkg.WithLevel(logger, level)
+	if *flagSilent {
+		mainLogger = pkg.SilentLogger{}
+	}
+
+	var history *pkg.History
+	if *flagHistory {
+		if history, err = pkg.OpenHistory(*flagStateDir); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+	}
+
+	bus := pkg.NewEventBus()
+
+	var metrics *pkg.Metrics
+	if *flagMetrics != "" {
+		metrics = pkg.NewMetrics()
+	}
+
+	runner, err := pkg.NewRunner(func() ([]*pkg.Watcher, error) {
+		cfg, err := loadConf()
+		if err != nil {
+			return nil, err
+		}
+
+		watchers, err := pkg.WatchersFromConf(cfg, logger, pkg.ExecutorFromName)
+		if err != nil {
+			return nil, fmt.Errorf("WatchersFromConf: %w", err)
+		}
+
+		if history != nil {
+			if err := history.Watch(watchers); err != nil {
+				mainLogger.Error("cannot write status", pkg.F(pkg.FieldError, err))
+			}
+		}
+		bus.Watch(watchers)
+		if metrics != nil {
+			metrics.Watch(watchers)
+		}
+
+		return watchers, nil
+	})
 	if err != nil {
-		log.Fatalf("error: WatchersFromConf: %v", err)
+		log.Fatalf("error: %v", err)
+	}
+
+	api := pkg.NewAPI(runner, bus)
+
+	if *flagListen != "" {
+		ln, err := net.Listen("tcp", *flagListen)
+		if err != nil {
+			log.Fatalf("error: api: %v", err)
+		}
+		warnExposed(mainLogger, "api", ln)
+
+		go func() {
+			if err := http.Serve(ln, api); err != nil {
+				mainLogger.Error("api stopped", pkg.F(pkg.FieldError, err))
+			}
+		}()
+		mainLogger.Info("serving api", pkg.F("address", ln.Addr().String()))
+	}
+
+	if *flagUI != "" {
+		ln, err := net.Listen("tcp", *flagUI)
+		if err != nil {
+			log.Fatalf("error: ui: %v", err)
+		}
+		warnExposed(mainLogger, "dashboard", ln)
+
+		go func() {
+			if err := http.Serve(ln, pkg.NewDashboard(api)); err != nil {
+				mainLogger.Error("ui stopped", pkg.F(pkg.FieldError, err))
+			}
+		}()
+		mainLogger.Info("serving dashboard", pkg.F("url", "http://"+ln.Addr().String()+"/"))
+	}
+
+	if metrics != nil {
+		ln, err := net.Listen("tcp", *flagMetrics)
+		if err != nil {
+			log.Fatalf("error: metrics: %v", err)
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics)
+		go func() {
+			if err := http.Serve(ln, mux); err != nil {
+				mainLogger.Error("metrics stopped", pkg.F(pkg.FieldError, err))
+			}
+		}()
+		mainLogger.Info("serving metrics", pkg.F("address", ln.Addr().String()))
+	}
+
+	socket := ""
+	if *flagControl {
+		if socket, err = controlSocket(*flagSocket); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+
+		ln, err := pkg.ListenControl(socket)
+		if err != nil {
+			mainLogger.Warn("control socket disabled", pkg.F(pkg.FieldError, err))
+			socket = ""
+		} else {
+			go func() {
+				if err := http.Serve(ln, api); err != nil {
+					mainLogger.Error("control socket closed", pkg.F(pkg.FieldError, err))
+				}
+			}()
+			mainLogger.Debug("listening on control socket", pkg.F(pkg.FieldPath, socket))
+		}
 	}
 
-	pkg.RunForever(watchers)
+	var keys *pkg.TerminalInput
+	if *flagKeys && pkg.IsTerminal(os.Stdin) {
+		if keys, err = pkg.NewTerminalInput(os.Stdin); err != nil {
+			mainLogger.Debug("keys disabled", pkg.F(pkg.FieldError, err))
+		}
+	}
+
+	// commands run in their own process group and would survive a Ctrl-C.
+	shutdown := func() {
+		pkg.TerminateProcesses()
+		if keys != nil {
+			_ = keys.Close()
+		}
+		if history != nil {
+			_ = os.Remove(history.StatusPath)
+		}
+		if socket != "" {
+			_ = os.Remove(socket)
+		}
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		shutdown()
+		log.Fatalf("stopped: %v", sig)
+	}()
+
+	if keys != nil {
+		// messages go to stderr, stdout may be the output of the stdout executor.
+		keyboard := &pkg.Keyboard{Runner: runner, Output: os.Stderr, Quit: func() {
+			shutdown()
+			mainLogger.Info("stopped")
+			os.Exit(0)
+		}}
+		go func() {
+			if err := keyboard.Run(keys); err != nil {
+				mainLogger.Error("keys disabled", pkg.F(pkg.FieldError, err))
+			}
+			_ = keys.Close()
+		}()
+		mainLogger.Info("reading keys, h for help")
+	}
+
+	// the watchers returned on their own, after an error of their notifier
+	// for instance.
+	runner.Run()
+	shutdown()
+}
+
+// warnExposed warns when the listener accepts connections from other hosts,
+// anyone reaching it can run the commands.
+func warnExposed(logger pkg.Logger, name string, ln net.Listener) {
+	if addr, ok := ln.Addr().(*net.TCPAddr); ok && !addr.IP.IsLoopback() {
+		logger.Warn(name+" reachable from other hosts, prefer a loopback address like 127.0.0.1", pkg.F("address", addr.String()))
+	}
 }
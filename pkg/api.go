@@ -0,0 +1,296 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// WatcherInfo describes a watcher in API responses.
+type WatcherInfo struct {
+	Name         string     `json:"name"`
+	State        string     `json:"state"`
+	Filter       string     `json:"filter,omitempty"`
+	Locations    int        `json:"locations"`
+	RunningSince *time.Time `json:"running_since,omitempty"`
+	LastRun      *RunRecord `json:"last_run,omitempty"`
+}
+
+// NewWatcherInfo returns the current state of the watcher.
+func NewWatcherInfo(w *Watcher) WatcherInfo {
+	state := w.State()
+	info := WatcherInfo{Name: w.Name, State: state.State, Locations: state.Locations, LastRun: state.LastRun}
+	if filter, ok := w.Filter.(fmt.Stringer); ok {
+		info.Filter = filter.String()
+	}
+	if !state.RunningSince.IsZero() {
+		info.RunningSince = &state.RunningSince
+	}
+	return info
+}
+
+// TriggerRequest is the optional body of a trigger request.
+type TriggerRequest struct {
+	// Paths are given to the run as written files, the first one to the
+	// command.
+	Paths []string `json:"paths"`
+}
+
+// sseKeepAlive is the interval of comments sent to keep event streams open
+// through proxies.
+const sseKeepAlive = time.Second * 15
+
+// NewAPI returns the handler of the HTTP API, answering in JSON:
+//
+//	GET  /watchers                 watchers with their state and last run
+//	GET  /watchers/<name>          a watcher
+//	POST /watchers/<name>/trigger  runs the command, the body can be a TriggerRequest,
+//	                               it waits for the run with ?wait=true
+//	POST /watchers/<name>/pause
+//	POST /watchers/<name>/resume
+//	POST /reload                   replaces the watchers, see Runner.Reload
+//	GET  /events                   Server-Sent Events of the bus, filtered with
+//	                               ?watcher=<name>&type=<type>[,<type>...]
+//
+// The bus can be nil, /events is then not found. Requests from browsers are
+// restricted, see guardRequest.
+func NewAPI(runner *Runner, bus *EventBus) http.Handler {
+	api := &api{runner: runner, bus: bus}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/watchers", api.list)
+	mux.HandleFunc("/watchers/", api.watcher)
+	mux.HandleFunc("/reload", api.reload)
+	if bus != nil {
+		mux.HandleFunc("/events", api.events)
+	}
+
+	return guardRequest(mux)
+}
+
+// guardRequest rejects the requests a page from another site could make a
+// browser send. The Host must be an IP address or localhost, so a domain
+// resolved to a local address cannot be used, the Origin of other requests
+// than GET must be the Host, and their body must be JSON, as forms cannot
+// send it.
+func guardRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !localHost(r.Host) {
+			writeAPIError(rw, http.StatusForbidden, fmt.Errorf("host %s not allowed", r.Host))
+			return
+		}
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			if origin := r.Header.Get("Origin"); origin != "" {
+				if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+					writeAPIError(rw, http.StatusForbidden, fmt.Errorf("origin %s not allowed", origin))
+					return
+				}
+			}
+
+			if contentType := r.Header.Get("Content-Type"); contentType != "" {
+				if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != "application/json" {
+					writeAPIError(rw, http.StatusUnsupportedMediaType, fmt.Errorf("content type %s not allowed, use application/json", contentType))
+					return
+				}
+			}
+		}
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// localHost returns true for IP addresses and localhost, with or without
+// a port.
+func localHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+
+	return host == "localhost" || strings.HasSuffix(host, ".localhost") || net.ParseIP(host) != nil
+}
+
+type api struct {
+	runner *Runner
+	bus    *EventBus
+}
+
+func (a *api) find(name string) *Watcher {
+	for _, w := range a.runner.Watchers() {
+		if w.Name == name {
+			return w
+		}
+	}
+	return nil
+}
+
+func (a *api) list(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(rw, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	writeAPIResponse(rw, http.StatusOK, a.infos())
+}
+
+func (a *api) infos() []WatcherInfo {
+	watchers := a.runner.Watchers()
+	infos := make([]WatcherInfo, 0, len(watchers))
+	for _, w := range watchers {
+		infos = append(infos, NewWatcherInfo(w))
+	}
+	return infos
+}
+
+func (a *api) reload(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(rw, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	if err := a.runner.Reload(); err != nil {
+		writeAPIError(rw, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	writeAPIResponse(rw, http.StatusOK, a.infos())
+}
+
+func (a *api) watcher(rw http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/watchers/"), "/", 2)
+
+	w := a.find(parts[0])
+	if w == nil {
+		writeAPIError(rw, http.StatusNotFound, fmt.Errorf("unknown watcher %s", parts[0]))
+		return
+	}
+
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	method := http.MethodPost
+	if action == "" {
+		method = http.MethodGet
+	}
+
+	if r.Method != method {
+		writeAPIError(rw, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	switch action {
+	case "":
+		writeAPIResponse(rw, http.StatusOK, NewWatcherInfo(w))
+	case "trigger":
+		a.trigger(rw, r, w)
+	case "pause":
+		w.Pause()
+		writeAPIResponse(rw, http.StatusOK, NewWatcherInfo(w))
+	case "resume":
+		w.Resume()
+		writeAPIResponse(rw, http.StatusOK, NewWatcherInfo(w))
+	default:
+		writeAPIError(rw, http.StatusNotFound, fmt.Errorf("unknown action %s", action))
+	}
+}
+
+func (a *api) trigger(rw http.ResponseWriter, r *http.Request, w *Watcher) {
+	var req TriggerRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(rw, http.StatusBadRequest, fmt.Errorf("trigger: %w", err))
+			return
+		}
+	}
+
+	if err := w.tryStart(); err != nil {
+		writeAPIError(rw, http.StatusConflict, err)
+		return
+	}
+
+	if r.URL.Query().Get("wait") != "true" {
+		go w.triggerStarted(req.Paths...)
+		writeAPIResponse(rw, http.StatusAccepted, NewWatcherInfo(w))
+		return
+	}
+
+	// a failed run is told by the last run of the watcher.
+	_ = w.triggerStarted(req.Paths...)
+
+	writeAPIResponse(rw, http.StatusOK, NewWatcherInfo(w))
+}
+
+func (a *api) events(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(rw, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		writeAPIError(rw, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	watcher := r.URL.Query().Get("watcher")
+	if watcher != "" && a.find(watcher) == nil {
+		writeAPIError(rw, http.StatusNotFound, fmt.Errorf("unknown watcher %s", watcher))
+		return
+	}
+
+	types := map[string]bool{}
+	if t := r.URL.Query().Get("type"); t != "" {
+		for _, name := range strings.Split(t, ",") {
+			types[name] = true
+		}
+	}
+
+	events, cancel := a.bus.Subscribe(256)
+	defer cancel()
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(rw, ": keep-alive\n\n")
+		case event := <-events:
+			if watcher != "" && event.Watcher != watcher || len(types) > 0 && !types[event.Type] {
+				continue
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(rw, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+		flusher.Flush()
+	}
+}
+
+func writeAPIResponse(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	_ = json.NewEncoder(rw).Encode(v)
+}
+
+func writeAPIError(rw http.ResponseWriter, status int, err error) {
+	writeAPIResponse(rw, status, map[string]string{"error": err.Error()})
+}
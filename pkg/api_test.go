@@ -0,0 +1,144 @@
+package pkg_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-ini/ini"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+func TestAPI(t *testing.T) {
+	cfg, err := ini.Load([]byte(`
+silent = true
+
+[build]
+command = echo built %event.file && sh -c "exit 1"
+
+[test]
+command = true
+`))
+	require.NoError(t, err)
+
+	watchers, err := pkg.WatchersFromConf(cfg, stderrLogger(t), pkg.ExecutorFromName)
+	require.NoError(t, err)
+
+	bus := pkg.NewEventBus()
+	bus.Watch(watchers)
+
+	runner, err := pkg.NewRunner(func() ([]*pkg.Watcher, error) { return watchers, nil })
+	require.NoError(t, err)
+
+	server := httptest.NewServer(pkg.NewAPI(runner, bus))
+	defer server.Close()
+
+	call := func(method, path, body string, status int, v interface{}) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, status, resp.StatusCode, path)
+		if v != nil {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		}
+	}
+
+	var infos []pkg.WatcherInfo
+	call(http.MethodGet, "/watchers", "", http.StatusOK, &infos)
+	require.Len(t, infos, 2)
+	require.Equal(t, "build", infos[0].Name)
+	require.Equal(t, pkg.StateIdle, infos[0].State)
+	require.Nil(t, infos[0].LastRun)
+
+	call(http.MethodGet, "/watchers/missing", "", http.StatusNotFound, nil)
+	call(http.MethodGet, "/watchers/build/trigger", "", http.StatusMethodNotAllowed, nil)
+	call(http.MethodPost, "/watchers/build/trigger", "{", http.StatusBadRequest, nil)
+
+	resp, err := http.Get(server.URL + "/events?watcher=build&type=output,run_finish")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	var info pkg.WatcherInfo
+	call(http.MethodPost, "/watchers/build/trigger?wait=true", `{"paths": ["a.go", "b.go"]}`, http.StatusOK, &info)
+	require.Equal(t, pkg.StateFailed, info.State)
+	require.Equal(t, 1, info.LastRun.ExitCode)
+	require.Equal(t, pkg.CauseManual, info.LastRun.Cause)
+	require.Equal(t, []pkg.RunEvent{{Path: "a.go", Op: "Write"}, {Path: "b.go", Op: "Write"}}, info.LastRun.Events)
+
+	stream := bufio.NewScanner(resp.Body)
+	var events []pkg.BusEvent
+	for len(events) < 2 && stream.Scan() {
+		if data := strings.TrimPrefix(stream.Text(), "data: "); data != stream.Text() {
+			var event pkg.BusEvent
+			require.NoError(t, json.Unmarshal([]byte(data), &event))
+			events = append(events, event)
+		}
+	}
+	require.Len(t, events, 2)
+	require.Equal(t, pkg.BusEventOutput, events[0].Type)
+	require.Equal(t, "built a.go", events[0].Line)
+	require.Equal(t, pkg.BusEventRunFinish, events[1].Type)
+	require.Equal(t, info.LastRun.ID, events[1].RunID)
+
+	call(http.MethodPost, "/watchers/test/pause", "", http.StatusOK, &info)
+	require.Equal(t, pkg.StatePaused, info.State)
+	require.True(t, watchers[1].Paused())
+
+	call(http.MethodPost, "/watchers/test/resume", "", http.StatusOK, &info)
+	require.Equal(t, pkg.StateIdle, info.State)
+	require.False(t, watchers[1].Paused())
+}
+
+func TestAPIGuard(t *testing.T) {
+	watchers, err := watchersFromString(t, "silent = true\n[test]\ncommand = true\n")
+	require.NoError(t, err)
+
+	runner, err := pkg.NewRunner(func() ([]*pkg.Watcher, error) { return watchers, nil })
+	require.NoError(t, err)
+
+	server := httptest.NewServer(pkg.NewAPI(runner, nil))
+	defer server.Close()
+
+	call := func(method, path, host string, headers map[string]string, status int) {
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		require.NoError(t, err)
+		if host != "" {
+			req.Host = host
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, status, resp.StatusCode, "%s %s %s %v", method, path, host, headers)
+	}
+
+	call(http.MethodGet, "/watchers", "", nil, http.StatusOK)
+	call(http.MethodGet, "/watchers", "localhost:7777", nil, http.StatusOK)
+	call(http.MethodGet, "/watchers", "[::1]:7777", nil, http.StatusOK)
+
+	// DNS rebinding.
+	call(http.MethodGet, "/watchers", "attacker.example:7777", nil, http.StatusForbidden)
+	call(http.MethodGet, "/watchers", "attacker.example", nil, http.StatusForbidden)
+
+	// cross-site requests.
+	call(http.MethodPost, "/watchers/test/pause", "", map[string]string{"Origin": "http://attacker.example"}, http.StatusForbidden)
+	call(http.MethodPost, "/watchers/test/pause", "", map[string]string{"Origin": "null"}, http.StatusForbidden)
+	call(http.MethodPost, "/watchers/test/pause", "", map[string]string{"Content-Type": "text/plain"}, http.StatusUnsupportedMediaType)
+	call(http.MethodPost, "/watchers/test/pause", "", map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, http.StatusUnsupportedMediaType)
+	require.False(t, watchers[0].Paused())
+
+	call(http.MethodPost, "/watchers/test/pause", "", map[string]string{"Origin": server.URL, "Content-Type": "application/json; charset=utf-8"}, http.StatusOK)
+	require.True(t, watchers[0].Paused())
+	call(http.MethodPost, "/watchers/test/resume", "", nil, http.StatusOK)
+	require.False(t, watchers[0].Paused())
+}
@@ -0,0 +1,141 @@
+package pkg
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// Types of bus events.
+const (
+	// BusEventFS is a file change, Accepted tells whether it ran the
+	// command, Reason why it did not.
+	BusEventFS = "fs"
+	// BusEventRunStart and BusEventRunFinish surround runs, Run is set.
+	BusEventRunStart  = "run_start"
+	BusEventRunFinish = "run_finish"
+	// BusEventOutput is an output line of a run.
+	BusEventOutput = "output"
+	// BusEventState is sent when the state of a watcher changed.
+	BusEventState = "state"
+)
+
+// Reasons of rejected file changes.
+const (
+	RejectFilter  = "filter"
+	RejectPaused  = "paused"
+	RejectRunning = "running"
+	RejectError   = "error"
+	RejectOp      = "op"
+)
+
+// BusEvent is something that happened to a watcher.
+type BusEvent struct {
+	Type     string     `json:"type"`
+	Watcher  string     `json:"watcher"`
+	Time     time.Time  `json:"time"`
+	Path     string     `json:"path,omitempty"`
+	Op       string     `json:"op,omitempty"`
+	Accepted bool       `json:"accepted,omitempty"`
+	Reason   string     `json:"reason,omitempty"`
+	Run      *RunRecord `json:"run,omitempty"`
+	RunID    int64      `json:"run_id,omitempty"`
+	Line     string     `json:"line,omitempty"`
+	State    string     `json:"state,omitempty"`
+}
+
+// EventBus sends the events of watchers to subscribers. Publishing never
+// blocks: events are dropped for subscribers not keeping up.
+type EventBus struct {
+	lock        sync.Mutex
+	subscribers map[chan BusEvent]struct{}
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[chan BusEvent]struct{})}
+}
+
+// Watch makes the watchers publish their events to the bus.
+func (b *EventBus) Watch(watchers []*Watcher) {
+	for _, w := range watchers {
+		w.Events = b
+	}
+}
+
+// Subscribe returns a channel receiving events until cancel is called.
+func (b *EventBus) Subscribe(size int) (events <-chan BusEvent, cancel func()) {
+	ch := make(chan BusEvent, size)
+
+	b.lock.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.lock.Unlock()
+
+	return ch, func() {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Publish sends the event to subscribers, its Time is set if zero.
+func (b *EventBus) Publish(event BusEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// busWriter publishes each output line of a run.
+type busWriter struct {
+	lock    sync.Mutex
+	bus     *EventBus
+	watcher string
+	runID   int64
+	partial []byte
+}
+
+func (w *busWriter) Write(b []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	data := append(w.partial, b...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		w.publish(data[:i])
+		data = data[i+1:]
+	}
+	w.partial = append([]byte(nil), data...)
+
+	return len(b), nil
+}
+
+func (w *busWriter) publish(line []byte) {
+	w.bus.Publish(BusEvent{Type: BusEventOutput, Watcher: w.watcher, RunID: w.runID, Line: string(StripANSI(bytes.TrimRight(line, "\r")))})
+}
+
+// Flush publishes the last line when it does not end with a new line.
+func (w *busWriter) Flush() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if len(w.partial) > 0 {
+		w.publish(w.partial)
+		w.partial = nil
+	}
+}
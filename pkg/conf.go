@@ -2,9 +2,14 @@ package pkg
 
 import (
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-ini/ini"
 )
@@ -14,22 +19,127 @@ const (
 	ExecutorUnixShell = "unixshell"
 	ExecutorStdout    = "stdout"
 	ExecutorRaw       = "raw"
+	ExecutorPTY       = "pty"
 )
 
 const (
-	CfgDebug    = "debug"
-	CfgSilent   = "silent"
-	CfgMatch    = "match"
-	CfgFilter   = "filter"
-	CfgCommand  = "command"
-	CfgExecutor = "executor"
+	CfgDebug = "debug"
+	// CfgLogLevel is error, warn, info, debug or trace, it overrides CfgDebug.
+	CfgLogLevel = "log_level"
+	// CfgLogOutput sends output lines of commands to the logger.
+	CfgLogOutput = "log_output"
+	CfgSilent    = "silent"
+	CfgMatch     = "match"
+	CfgFilter    = "filter"
+	CfgCommand   = "command"
+	CfgExecutor  = "executor"
+	CfgWorkDir   = "workdir"
+	CfgEnvFile   = "env_file"
+	CfgShell     = "shell"
+	// CfgShellArgs is split on spaces, the command is given after them.
+	CfgShellArgs = "shell_args"
+	CfgTimeout   = "timeout"
+	CfgKillGrace = "kill_grace"
+	CfgRetries   = "retries"
+	// CfgRetryBackoff is a duration range as min..max, like 1s..30s
+	CfgRetryBackoff = "retry_backoff"
+	// CfgBreaker is the number of consecutive failed runs pausing a watcher
+	CfgBreaker = "breaker"
+	// Hooks, see Hooks
+	CfgOnStart   = "on_start"
+	CfgOnSuccess = "on_success"
+	CfgOnFailure = "on_failure"
+	// CfgStepPrefix starts the keys of pipeline steps, run in order:
+	// step.1 = command, with optional step.1.executor, step.1.timeout and
+	// step.1.continue_on_error keys.
+	CfgStepPrefix      = "step."
+	CfgContinueOnError = "continue_on_error"
+	// Comma separated watcher names, see LinkWatchers
+	CfgAfter   = "after"
+	CfgTrigger = "trigger"
+	// CfgMaxJobs is only read from the DEFAULT section, as CfgPoolPrefix
+	// keys defining pool sizes: pool.NAME = size. CfgPool is the pool of a
+	// watcher.
+	CfgMaxJobs    = "max_jobs"
+	CfgPoolPrefix = "pool."
+	CfgPool       = "pool"
+	// CfgPrefix prefixes each output line with the watcher name, by default
+	// when there are several watchers and the output is a terminal.
+	// CfgColor defaults to true when the output is a terminal.
+	// CfgOutput is the output mode, see OutputStream, OutputOnFailure and OutputDiff
+	CfgOutput = "output"
+	CfgPrefix = "prefix"
+	CfgColor  = "color"
+	// CfgOutputFile is a path where %watcher is replaced with the watcher
+	// name, see OutputFile for the other keys.
+	CfgOutputFile          = "output_file"
+	CfgOutputFileMaxSize   = "output_file_max_size"
+	CfgOutputFileMaxRuns   = "output_file_max_runs"
+	CfgOutputFileKeep      = "output_file_keep"
+	CfgOutputFileStripANSI = "output_file_strip_ansi"
+	// CfgProblemMatcher is go, gcc, eslint or a regular expression, see
+	// NewProblemMatcher. Diagnostics are written to the quickfix and
+	// diagnostics files, where %watcher is replaced with the watcher name.
+	CfgProblemMatcher  = "problem_matcher"
+	CfgQuickfixFile    = "quickfix_file"
+	CfgDiagnosticsFile = "diagnostics_file"
+	// Limits of the resources of commands, see Limits. Sizes are given as
+	// 512M, 2G...
+	CfgNice        = "nice"
+	CfgIONice      = "ionice"
+	CfgLimitCPU    = "limit_cpu"
+	CfgLimitAS     = "limit_as"
+	CfgLimitNoFile = "limit_nofile"
+	CfgLimitMemory = "limit_memory"
+	// CfgMode is command or service, see ServiceOptions for the ready keys.
+	CfgMode         = "mode"
+	CfgReadyTCP     = "ready_tcp"
+	CfgReadyHTTP    = "ready_http"
+	CfgReadyOutput  = "ready_output"
+	CfgReadyTimeout = "ready_timeout"
+	// Presentation of runs, see Presenter. Only used when the output is a
+	// terminal.
+	CfgClear  = "clear"
+	CfgBanner = "banner"
+	CfgTitle  = "title"
+	CfgBell   = "bell"
+	// CfgEnvPrefix is the prefix of keys defining environment variables: env.NAME = value
+	CfgEnvPrefix = "env."
 )
 
 type Cfg struct {
 	// available for defaults
 	Debug        bool
+	LogLevel     string
+	LogOutput    bool
 	ExecutorName string
 	Silent       bool
+	WorkDir      string
+	EnvFile      string
+	Shell        string
+	ShellArgs    string
+	Timeout      time.Duration
+	KillGrace    time.Duration
+	Retry        RetryPolicy
+	Breaker      int
+	Limits       Limits
+	// Hooks only holds command templates
+	Hooks      Hooks
+	Mode       string
+	Prefix     bool
+	Color      bool
+	Presenter  Presenter
+	OutputMode string
+	// OutputFile holds the settings of the output file, its Path is a template
+	OutputFile OutputFileSettings
+	// ProblemMatcher, QuickfixFile and DiagnosticsFile are templates
+	ProblemMatcher  string
+	QuickfixFile    string
+	DiagnosticsFile string
+	// PrefixWidth is the length of the longest watcher name, to align prefixes
+	PrefixWidth int
+	// Env holds KEY=VALUE entries, values are expanded when the watcher is built
+	Env []string
 	// NOT available for defaults
 	Name string
 	// Match defaults to "." if it is empty
@@ -40,16 +150,31 @@ type Cfg struct {
 	CommandTemplate string
 }
 
-type ExecutorProvider func(name, commandTemplate string) (Executor, error)
+type ExecutorProvider func(name, commandTemplate string, opts ExecOptions) (Executor, error)
+
+func ExecutorFromName(name, commandTemplate string, opts ExecOptions) (Executor, error) {
+	output := opts.Output
+	if output == nil {
+		output = os.Stdout
+	}
 
-func ExecutorFromName(name, commandTemplate string) (Executor, error) {
 	switch name {
 	case ExecutorRaw:
-		return NewExecutorRaw(os.Stdout, commandTemplate), nil
+		return NewExecutorRaw(output, commandTemplate, opts), nil
 	case ExecutorStdout:
-		return NewExecutorPrintPath(os.Stdout), nil
+		return NewExecutorPrintPath(output), nil
+	case ExecutorPTY:
+		e, err := NewExecutorPTY(output, commandTemplate, opts)
+		if err != nil {
+			return nil, fmt.Errorf("conf: %w", err)
+		}
+		return e, nil
 	case ExecutorUnixShell:
-		return NewExecutorUnixShell(os.Stdout, commandTemplate), nil
+		e, err := NewExecutorShell(output, commandTemplate, opts)
+		if err != nil {
+			return nil, fmt.Errorf("conf: %w", err)
+		}
+		return e, nil
 	default:
 		return nil, fmt.Errorf("conf: unknown executor type %s", name)
 	}
@@ -79,43 +204,228 @@ func BuildIniCfgFrom(cfg Cfg) *ini.File {
 		section.NewKey(CfgSilent, "true")
 	}
 
+	if cfg.LogLevel != "" {
+		section.NewKey(CfgLogLevel, cfg.LogLevel)
+	}
+
+	if cfg.LogOutput {
+		section.NewKey(CfgLogOutput, "true")
+	}
+
 	if cfg.ExecutorName != "" {
 		section.NewKey(CfgExecutor, cfg.ExecutorName)
 	}
 
+	if cfg.Mode != "" {
+		section.NewKey(CfgMode, cfg.Mode)
+	}
+
+	if cfg.OutputMode != "" {
+		section.NewKey(CfgOutput, cfg.OutputMode)
+	}
+
+	if cfg.ProblemMatcher != "" {
+		section.NewKey(CfgProblemMatcher, cfg.ProblemMatcher)
+	}
+
+	if cfg.QuickfixFile != "" {
+		section.NewKey(CfgQuickfixFile, cfg.QuickfixFile)
+	}
+
+	if cfg.DiagnosticsFile != "" {
+		section.NewKey(CfgDiagnosticsFile, cfg.DiagnosticsFile)
+	}
+
+	if cfg.Timeout > 0 {
+		section.NewKey(CfgTimeout, cfg.Timeout.String())
+	}
+
+	if cfg.KillGrace > 0 {
+		section.NewKey(CfgKillGrace, cfg.KillGrace.String())
+	}
+
+	if cfg.Retry.Retries > 0 {
+		section.NewKey(CfgRetries, strconv.Itoa(cfg.Retry.Retries))
+		section.NewKey(CfgRetryBackoff, cfg.Retry.MinBackoff.String()+".."+cfg.Retry.MaxBackoff.String())
+	}
+
+	if cfg.Breaker > 0 {
+		section.NewKey(CfgBreaker, strconv.Itoa(cfg.Breaker))
+	}
+
+	for key, on := range map[string]bool{
+		CfgClear:  cfg.Presenter.Clear,
+		CfgBanner: cfg.Presenter.Banner,
+		CfgTitle:  cfg.Presenter.Title,
+		CfgBell:   cfg.Presenter.Bell,
+	} {
+		if on {
+			section.NewKey(key, "true")
+		}
+	}
+
+	for key, hook := range map[string]string{
+		CfgOnStart:   cfg.Hooks.OnStart,
+		CfgOnSuccess: cfg.Hooks.OnSuccess,
+		CfgOnFailure: cfg.Hooks.OnFailure,
+	} {
+		if hook != "" {
+			section.NewKey(key, hook)
+		}
+	}
+
+	if cfg.WorkDir != "" {
+		section.NewKey(CfgWorkDir, cfg.WorkDir)
+	}
+
+	if cfg.EnvFile != "" {
+		section.NewKey(CfgEnvFile, cfg.EnvFile)
+	}
+
+	if cfg.Shell != "" {
+		section.NewKey(CfgShell, cfg.Shell)
+	}
+
+	if cfg.ShellArgs != "" {
+		section.NewKey(CfgShellArgs, cfg.ShellArgs)
+	}
+
+	for _, kv := range cfg.Env {
+		if parts := strings.SplitN(kv, "=", 2); len(parts) == 2 {
+			section.NewKey(CfgEnvPrefix+parts[0], parts[1])
+		}
+	}
+
 	return iniCfg
 }
 
-func WatcherFromConf(iniCfg *ini.Section, logger *log.Logger, defaults Cfg, prov ExecutorProvider) (*Watcher, error) {
+func WatcherFromConf(iniCfg *ini.Section, logger Logger, defaults Cfg, prov ExecutorProvider) (*Watcher, error) {
 	name := iniCfg.Name()
 	match := iniCfg.Key(CfgMatch).MustString(".")
 	command := iniCfg.Key(CfgCommand).String()
-	if command == "" {
+	steps := stepKeys(iniCfg)
+	if command == "" && len(steps) == 0 {
 		return nil, fmt.Errorf("conf: missing required 'command' key")
+	} else if command != "" && len(steps) > 0 {
+		return nil, fmt.Errorf("conf: %s: 'command' and '%sN' keys cannot be used together", name, CfgStepPrefix)
 	}
 	filter := regexp.MustCompile(iniCfg.Key(CfgFilter).MustString(".*"))
-	executor, err := prov(iniCfg.Key(CfgExecutor).MustString(defaults.ExecutorName), command)
+
+	opts, err := execOptionsFromConf(iniCfg, defaults)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("conf: %s: %w", name, err)
 	}
 
-	debug := iniCfg.Key(CfgDebug).MustBool(defaults.Debug)
-	silent := iniCfg.Key(CfgSilent).MustBool(defaults.Silent)
+	executorName := iniCfg.Key(CfgExecutor).MustString(defaults.ExecutorName)
+
+	color := iniCfg.Key(CfgColor).MustBool(defaults.Color)
+	stdout, stderr := io.Writer(os.Stdout), io.Writer(os.Stderr)
+	if iniCfg.Key(CfgPrefix).MustBool(defaults.Prefix) {
+		prefix := WatcherPrefix(name, defaults.PrefixWidth, color)
+		stdout = NewPrefixWriter(stdout, prefix)
+		stderr = NewPrefixWriter(stderr, prefix)
+	}
 
-	finder := LocalFinder{Match: match}
+	opts.Output = stdout
+	opts.ErrOutput = stderr
 
-	notifier := NewFSNotifyNotifier()
+	hooks := Hooks{
+		OnStart:      iniCfg.Key(CfgOnStart).MustString(defaults.Hooks.OnStart),
+		OnSuccess:    iniCfg.Key(CfgOnSuccess).MustString(defaults.Hooks.OnSuccess),
+		OnFailure:    iniCfg.Key(CfgOnFailure).MustString(defaults.Hooks.OnFailure),
+		ExecutorName: ExecutorUnixShell,
+		Options:      opts,
+		Provider:     prov,
+	}
 
-	var wLogger Logger
-	wLogger = InfoLogger{Logger: logger}
+	debug := iniCfg.Key(CfgDebug).MustBool(defaults.Debug)
+	silent := iniCfg.Key(CfgSilent).MustBool(defaults.Silent)
+
+	level := LevelInfo
 	if debug {
-		wLogger = DebugLogger{Logger: wLogger}
+		level = LevelDebug
+	}
+
+	if name := iniCfg.Key(CfgLogLevel).MustString(defaults.LogLevel); name != "" {
+		if level, err = ParseLevel(name); err != nil {
+			return nil, fmt.Errorf("conf: %s: %w", iniCfg.Name(), err)
+		}
 	}
 
+	var wLogger Logger
+	wLogger = WithLevel(logger, level)
 	if silent {
 		wLogger = SilentLogger{}
 	}
 
+	// the output of hooks is not captured.
+	output := NewRunOutput(stdout, stderr)
+	opts.Output = output.Stdout()
+	opts.ErrOutput = output.Stderr()
+	opts.Logger = wLogger
+
+	// the output is logged whatever the log level of the watcher.
+	var logOutput *LogWriter
+	if iniCfg.Key(CfgLogOutput).MustBool(defaults.LogOutput) && !silent {
+		logOutput = NewLogWriter(logger, F(FieldWatcher, name))
+		output.Attach(logOutput)
+	}
+
+	retry, err := retryFromConf(iniCfg, defaults.Retry)
+	if err != nil {
+		return nil, fmt.Errorf("conf: %s: %w", name, err)
+	}
+
+	mode := iniCfg.Key(CfgMode).MustString(defaults.Mode)
+	if mode == "" {
+		mode = ModeCommand
+	}
+
+	var executor Executor
+	switch {
+	case mode == ModeService:
+		executor, err = serviceFromConf(iniCfg, len(steps) > 0, executorName, command, opts, retry, wLogger)
+		if err != nil {
+			return nil, fmt.Errorf("conf: %s: %w", name, err)
+		}
+	case mode != ModeCommand:
+		return nil, fmt.Errorf("conf: %s: unknown mode %s", name, mode)
+	case len(steps) > 0:
+		executor, err = pipelineFromConf(iniCfg, steps, wLogger, executorName, opts, prov)
+	default:
+		executor, err = prov(executorName, command, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	finder := LocalFinder{Match: match, Logger: wLogger}
+
+	outputFile, err := outputFileFromConf(iniCfg, defaults.OutputFile)
+	if err != nil {
+		return nil, fmt.Errorf("conf: %s: %w", name, err)
+	}
+
+	problems, err := problemsFromConf(iniCfg, defaults, opts.WorkDir)
+	if err != nil {
+		return nil, fmt.Errorf("conf: %s: %w", name, err)
+	}
+
+	outputMode := iniCfg.Key(CfgOutput).MustString(defaults.OutputMode)
+	switch outputMode {
+	case "", OutputStream, OutputOnFailure, OutputDiff:
+	default:
+		return nil, fmt.Errorf("conf: %s: unknown output mode %s", name, outputMode)
+	}
+
+	if mode == ModeService && (outputMode == OutputOnFailure || outputMode == OutputDiff) {
+		return nil, fmt.Errorf("conf: %s: output mode %s cannot be used with mode %s", name, outputMode, ModeService)
+	}
+
+	// the notifier holds an inotify instance, it is created once the
+	// configuration is known to be valid.
+	notifier := NewFSNotifyNotifier()
+
 	w, err := NewWatcher(
 		name,
 		finder,
@@ -124,11 +434,352 @@ func WatcherFromConf(iniCfg *ini.Section, logger *log.Logger, defaults Cfg, prov
 		executor,
 		wLogger,
 	)
+	if err != nil {
+		notifier.Close()
+		return nil, err
+	}
+
+	w.Mode = mode
+	w.OutputMode = outputMode
+	w.Retry = retry
+	w.Hooks = hooks
+	w.Output = output
+	w.LogOutput = logOutput
+	w.OutputFile = outputFile
+	w.Problems = problems
 
-	return w, err
+	if problems != nil {
+		for _, path := range []string{problems.QuickfixFile, problems.JSONFile} {
+			if abs, err := filepath.Abs(path); path != "" && err == nil {
+				w.Ignore = append(w.Ignore, abs)
+			}
+		}
+	}
+
+	// each run appends to the output file, and rotates it.
+	if outputFile != nil {
+		if abs, err := filepath.Abs(outputFile.Path); err == nil {
+			w.Ignore = append(w.Ignore, abs)
+			for i := 1; i <= outputFile.Keep; i++ {
+				w.Ignore = append(w.Ignore, fmt.Sprintf("%s.%d", abs, i))
+			}
+		}
+	}
+
+	presenter := &Presenter{
+		Output:   stdout,
+		Terminal: os.Stdout,
+		Clear:    iniCfg.Key(CfgClear).MustBool(defaults.Presenter.Clear),
+		Banner:   iniCfg.Key(CfgBanner).MustBool(defaults.Presenter.Banner),
+		Title:    iniCfg.Key(CfgTitle).MustBool(defaults.Presenter.Title),
+		Bell:     iniCfg.Key(CfgBell).MustBool(defaults.Presenter.Bell),
+		Color:    color,
+	}
+
+	if IsTerminal(os.Stdout) && (presenter.Clear || presenter.Banner || presenter.Title || presenter.Bell) {
+		w.Presenter = presenter
+	}
+	w.Breaker.Threshold = iniCfg.Key(CfgBreaker).MustInt(defaults.Breaker)
+
+	return w, nil
+}
+
+var stepKeyRe = regexp.MustCompile(`^` + regexp.QuoteMeta(CfgStepPrefix) + `(\d+)$`)
+
+// stepKeys returns the step.N keys of the section, ordered by N.
+func stepKeys(iniCfg *ini.Section) []string {
+	keys := make([]string, 0)
+	for _, key := range iniCfg.Keys() {
+		if stepKeyRe.MatchString(key.Name()) {
+			keys = append(keys, key.Name())
+		}
+	}
+
+	stepNumber := func(key string) int {
+		n, _ := strconv.Atoi(stepKeyRe.FindStringSubmatch(key)[1])
+		return n
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		return stepNumber(keys[i]) < stepNumber(keys[j])
+	})
+
+	return keys
 }
 
-func WatchersFromConf(inicfg *ini.File, logger *log.Logger, prov ExecutorProvider) ([]*Watcher, error) {
+// pipelineFromConf builds an executor for each step, with the executor and
+// timeout of the watcher unless overridden by step.N.executor and
+// step.N.timeout.
+func pipelineFromConf(iniCfg *ini.Section, keys []string, logger Logger, executorName string, opts ExecOptions, prov ExecutorProvider) (Executor, error) {
+	steps := make([]Step, 0, len(keys))
+
+	for _, key := range keys {
+		stepOpts := opts
+
+		var err error
+		if stepOpts.Timeout, err = durationFromConf(iniCfg, key+"."+CfgTimeout, opts.Timeout); err != nil {
+			return nil, fmt.Errorf("conf: %s: %w", iniCfg.Name(), err)
+		}
+
+		executor, err := prov(iniCfg.Key(key+"."+CfgExecutor).MustString(executorName), iniCfg.Key(key).String(), stepOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		steps = append(steps, Step{
+			Name:            strings.TrimPrefix(key, CfgStepPrefix),
+			Executor:        executor,
+			ContinueOnError: iniCfg.Key(key + "." + CfgContinueOnError).MustBool(false),
+		})
+	}
+
+	return NewExecutorPipeline(iniCfg.Name(), logger, steps), nil
+}
+
+// durationFromConf parses a duration like 1m30s, falling back to def when
+// the key is missing or empty.
+func durationFromConf(iniCfg *ini.Section, key string, def time.Duration) (time.Duration, error) {
+	value := iniCfg.Key(key).String()
+	if value == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+
+	return d, nil
+}
+
+// retryFromConf reads the number of retries and the backoff range.
+func retryFromConf(iniCfg *ini.Section, def RetryPolicy) (RetryPolicy, error) {
+	retry := def
+	retry.Retries = iniCfg.Key(CfgRetries).MustInt(def.Retries)
+
+	if value := iniCfg.Key(CfgRetryBackoff).String(); value != "" {
+		var err error
+		if retry.MinBackoff, retry.MaxBackoff, err = ParseBackoff(value); err != nil {
+			return retry, fmt.Errorf("%s: %w", CfgRetryBackoff, err)
+		}
+	}
+
+	return retry, nil
+}
+
+// outputFileFromConf returns nil if no output file is set.
+func outputFileFromConf(iniCfg *ini.Section, def OutputFileSettings) (*OutputFile, error) {
+	path := iniCfg.Key(CfgOutputFile).MustString(def.Path)
+	if path == "" {
+		return nil, nil
+	}
+
+	f := OutputFileSettings{
+		Path:      strings.Replace(ExpandEnv(path, nil), "%watcher", iniCfg.Name(), -1),
+		MaxSize:   def.MaxSize,
+		MaxRuns:   iniCfg.Key(CfgOutputFileMaxRuns).MustInt(def.MaxRuns),
+		Keep:      iniCfg.Key(CfgOutputFileKeep).MustInt(def.Keep),
+		StripANSI: iniCfg.Key(CfgOutputFileStripANSI).MustBool(def.StripANSI),
+	}
+
+	if size := iniCfg.Key(CfgOutputFileMaxSize).String(); size != "" {
+		var err error
+		if f.MaxSize, err = ParseSize(size); err != nil {
+			return nil, fmt.Errorf("%s: %w", CfgOutputFileMaxSize, err)
+		}
+	}
+
+	return NewOutputFile(f), nil
+}
+
+// serviceFromConf returns the executor of a watcher in service mode, it is
+// restarted with the retry backoff.
+func serviceFromConf(iniCfg *ini.Section, hasSteps bool, executorName, command string, opts ExecOptions, retry RetryPolicy, logger Logger) (Executor, error) {
+	if hasSteps {
+		return nil, fmt.Errorf("'%sN' keys cannot be used with mode %s", CfgStepPrefix, ModeService)
+	}
+
+	if executorName != ExecutorUnixShell {
+		return nil, fmt.Errorf("executor %s cannot be used with mode %s", executorName, ModeService)
+	}
+
+	service := ServiceOptions{
+		ReadyTCP:  iniCfg.Key(CfgReadyTCP).String(),
+		ReadyHTTP: iniCfg.Key(CfgReadyHTTP).String(),
+		Restart:   retry,
+	}
+
+	if expr := iniCfg.Key(CfgReadyOutput).String(); expr != "" {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", CfgReadyOutput, err)
+		}
+		service.ReadyOutput = re
+	}
+
+	var err error
+	if service.ReadyTimeout, err = durationFromConf(iniCfg, CfgReadyTimeout, DefaultReadyTimeout); err != nil {
+		return nil, err
+	}
+
+	return NewExecutorService(iniCfg.Name(), opts.Output, command, opts, service, logger)
+}
+
+// problemsFromConf returns nil if no problem matcher is set.
+func problemsFromConf(iniCfg *ini.Section, defaults Cfg, workDir string) (*Problems, error) {
+	name := iniCfg.Key(CfgProblemMatcher).MustString(defaults.ProblemMatcher)
+	if name == "" {
+		return nil, nil
+	}
+
+	matcher, err := NewProblemMatcher(name)
+	if err != nil {
+		return nil, err
+	}
+
+	path := func(key, def string) string {
+		return strings.Replace(ExpandEnv(iniCfg.Key(key).MustString(def), nil), "%watcher", iniCfg.Name(), -1)
+	}
+
+	return &Problems{
+		Matcher:      matcher,
+		WorkDir:      workDir,
+		QuickfixFile: path(CfgQuickfixFile, defaults.QuickfixFile),
+		JSONFile:     path(CfgDiagnosticsFile, defaults.DiagnosticsFile),
+	}, nil
+}
+
+// envFromSection returns env.NAME keys of the section as NAME=value entries,
+// in their order of definition.
+func envFromSection(iniCfg *ini.Section) []string {
+	env := make([]string, 0)
+	for _, key := range iniCfg.Keys() {
+		if strings.HasPrefix(key.Name(), CfgEnvPrefix) {
+			env = append(env, strings.TrimPrefix(key.Name(), CfgEnvPrefix)+"="+key.Value())
+		}
+	}
+	return env
+}
+
+// execOptionsFromConf builds the working directory, shell, timeouts and
+// environment of a watcher. The env file is loaded first, then env.NAME keys from the defaults
+// and from the section, each value being expanded with the variables defined
+// before it.
+func execOptionsFromConf(iniCfg *ini.Section, defaults Cfg) (ExecOptions, error) {
+	opts := ExecOptions{
+		WorkDir: ExpandEnv(iniCfg.Key(CfgWorkDir).MustString(defaults.WorkDir), nil),
+		Shell:   ExpandEnv(iniCfg.Key(CfgShell).MustString(defaults.Shell), nil),
+	}
+
+	var err error
+	if opts.Timeout, err = durationFromConf(iniCfg, CfgTimeout, defaults.Timeout); err != nil {
+		return opts, err
+	}
+
+	if opts.KillGrace, err = durationFromConf(iniCfg, CfgKillGrace, defaults.KillGrace); err != nil {
+		return opts, err
+	}
+
+	if opts.Limits, err = limitsFromConf(iniCfg, defaults.Limits); err != nil {
+		return opts, err
+	}
+
+	if shellArgs := iniCfg.Key(CfgShellArgs).MustString(defaults.ShellArgs); shellArgs != "" {
+		opts.ShellArgs = strings.Fields(shellArgs)
+	}
+
+	env := make([]string, 0)
+
+	// a relative env file is looked up from the working directory of the watcher.
+	if envFile := ExpandEnv(iniCfg.Key(CfgEnvFile).MustString(defaults.EnvFile), nil); envFile != "" {
+		if !filepath.IsAbs(envFile) {
+			envFile = filepath.Join(opts.WorkDir, envFile)
+		}
+
+		if env, err = ParseEnvFile(envFile, env); err != nil {
+			return opts, err
+		}
+	}
+
+	vars := append(append([]string{}, defaults.Env...), envFromSection(iniCfg)...)
+	for _, kv := range vars {
+		parts := strings.SplitN(kv, "=", 2)
+		env = append(env, parts[0]+"="+ExpandEnv(parts[1], env))
+	}
+
+	if len(env) > 0 {
+		opts.Env = env
+	}
+
+	return opts, nil
+}
+
+// limitsFromConf reads the limits of commands, missing keys keep the ones
+// of def.
+func limitsFromConf(iniCfg *ini.Section, def Limits) (Limits, error) {
+	limits := def
+
+	if nice := iniCfg.Key(CfgNice).String(); nice != "" {
+		n, err := strconv.Atoi(nice)
+		if err != nil || n < -20 || n > 19 {
+			return limits, fmt.Errorf("%s: must be from -20 to 19: %s", CfgNice, nice)
+		}
+		limits.Nice = n
+	}
+
+	if ionice := iniCfg.Key(CfgIONice).String(); ionice != "" {
+		class, level, err := ParseIONice(ionice)
+		if err != nil {
+			return limits, err
+		}
+		limits.IOClass, limits.IOLevel = class, level
+	}
+
+	var err error
+	if limits.CPU, err = durationFromConf(iniCfg, CfgLimitCPU, def.CPU); err != nil {
+		return limits, err
+	}
+
+	for key, size := range map[string]*int64{CfgLimitAS: &limits.AS, CfgLimitMemory: &limits.Memory} {
+		if value := iniCfg.Key(key).String(); value != "" {
+			if *size, err = ParseSize(value); err != nil {
+				return limits, fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+
+	if nofile := iniCfg.Key(CfgLimitNoFile).String(); nofile != "" {
+		if limits.NoFile, err = strconv.ParseUint(nofile, 10, 64); err != nil {
+			return limits, fmt.Errorf("%s: %w", CfgLimitNoFile, err)
+		}
+	}
+
+	return limits, checkLimits(limits)
+}
+
+// schedulerFromConf returns a scheduler if max_jobs or pools are set.
+func schedulerFromConf(defaultSection *ini.Section) (*Scheduler, error) {
+	maxJobs := defaultSection.Key(CfgMaxJobs).MustInt(0)
+	pools := make(map[string]int)
+
+	for _, key := range defaultSection.Keys() {
+		if strings.HasPrefix(key.Name(), CfgPoolPrefix) {
+			size, err := key.Int()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key.Name(), err)
+			}
+			pools[strings.TrimPrefix(key.Name(), CfgPoolPrefix)] = size
+		}
+	}
+
+	if maxJobs <= 0 && len(pools) == 0 {
+		return nil, nil
+	}
+
+	return NewScheduler(maxJobs, pools), nil
+}
+
+func WatchersFromConf(inicfg *ini.File, logger Logger, prov ExecutorProvider) ([]*Watcher, error) {
 	// we only have the DEFAULT section
 	if len(inicfg.Sections()) == 1 {
 		return nil, fmt.Errorf("conf: no configuration")
@@ -140,18 +791,124 @@ func WatchersFromConf(inicfg *ini.File, logger *log.Logger, prov ExecutorProvide
 	// fallback to hardcoded values for keys missing in that section.
 	defaults := Cfg{
 		Debug:        defaultSection.Key(CfgDebug).MustBool(false),
+		LogLevel:     defaultSection.Key(CfgLogLevel).String(),
+		LogOutput:    defaultSection.Key(CfgLogOutput).MustBool(false),
 		ExecutorName: defaultSection.Key(CfgExecutor).MustString(ExecutorUnixShell),
 		Silent:       defaultSection.Key(CfgSilent).MustBool(false),
+		WorkDir:      defaultSection.Key(CfgWorkDir).String(),
+		EnvFile:      defaultSection.Key(CfgEnvFile).String(),
+		Shell:        defaultSection.Key(CfgShell).String(),
+		ShellArgs:    defaultSection.Key(CfgShellArgs).String(),
+		Env:          envFromSection(defaultSection),
+	}
+
+	var err error
+	if defaults.Timeout, err = durationFromConf(defaultSection, CfgTimeout, 0); err != nil {
+		return nil, fmt.Errorf("conf: %s: %w", ini.DefaultSection, err)
 	}
 
+	if defaults.KillGrace, err = durationFromConf(defaultSection, CfgKillGrace, 0); err != nil {
+		return nil, fmt.Errorf("conf: %s: %w", ini.DefaultSection, err)
+	}
+
+	if defaults.Limits, err = limitsFromConf(defaultSection, Limits{}); err != nil {
+		return nil, fmt.Errorf("conf: %s: %w", ini.DefaultSection, err)
+	}
+
+	defaults.Retry, err = retryFromConf(defaultSection, RetryPolicy{
+		MinBackoff: DefaultRetryMinBackoff,
+		MaxBackoff: DefaultRetryMaxBackoff,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("conf: %s: %w", ini.DefaultSection, err)
+	}
+
+	tty := IsTerminal(os.Stdout)
+	defaults.Prefix = defaultSection.Key(CfgPrefix).MustBool(len(inicfg.Sections()) > 2 && tty)
+	defaults.Color = defaultSection.Key(CfgColor).MustBool(tty)
+	for _, section := range inicfg.Sections()[1:] {
+		if len(section.Name()) > defaults.PrefixWidth {
+			defaults.PrefixWidth = len(section.Name())
+		}
+	}
+
+	// the path is a template, resolved by each watcher.
+	defaults.OutputFile = OutputFileSettings{Keep: DefaultOutputFileKeep}
+	defaultOutputFile, err := outputFileFromConf(defaultSection, defaults.OutputFile)
+	if err != nil {
+		return nil, fmt.Errorf("conf: %s: %w", ini.DefaultSection, err)
+	}
+	if defaultOutputFile != nil {
+		defaults.OutputFile = defaultOutputFile.OutputFileSettings
+		defaults.OutputFile.Path = defaultSection.Key(CfgOutputFile).String()
+	}
+
+	defaults.OutputMode = defaultSection.Key(CfgOutput).MustString(OutputStream)
+	defaults.Mode = defaultSection.Key(CfgMode).MustString(ModeCommand)
+	defaults.ProblemMatcher = defaultSection.Key(CfgProblemMatcher).String()
+	defaults.QuickfixFile = defaultSection.Key(CfgQuickfixFile).MustString(DefaultQuickfixFile)
+	defaults.DiagnosticsFile = defaultSection.Key(CfgDiagnosticsFile).MustString(DefaultDiagnosticsFile)
+	defaults.Presenter = Presenter{
+		Clear:  defaultSection.Key(CfgClear).MustBool(false),
+		Banner: defaultSection.Key(CfgBanner).MustBool(false),
+		Title:  defaultSection.Key(CfgTitle).MustBool(false),
+		Bell:   defaultSection.Key(CfgBell).MustBool(false),
+	}
+
+	defaults.Breaker = defaultSection.Key(CfgBreaker).MustInt(0)
+	defaults.Hooks = Hooks{
+		OnStart:   defaultSection.Key(CfgOnStart).String(),
+		OnSuccess: defaultSection.Key(CfgOnSuccess).String(),
+		OnFailure: defaultSection.Key(CfgOnFailure).String(),
+	}
+
+	scheduler, err := schedulerFromConf(defaultSection)
+	if err != nil {
+		return nil, fmt.Errorf("conf: %s: %w", ini.DefaultSection, err)
+	}
+	defaultPool := defaultSection.Key(CfgPool).String()
+
 	watchers := make([]*Watcher, 0)
+	after := make(map[string][]string)
+	triggers := make(map[string][]string)
+	// outputFiles holds the watcher writing each output file, as two
+	// watchers would rotate the same files.
+	outputFiles := make(map[string]string)
+
 	// exclude the DEFAULT section, which comes first
 	for _, section := range inicfg.Sections()[1:] {
-		if w, err := WatcherFromConf(section, logger, defaults, prov); err != nil {
+		w, err := WatcherFromConf(section, logger, defaults, prov)
+		if err != nil {
 			return nil, err
-		} else {
-			watchers = append(watchers, w)
 		}
+		watchers = append(watchers, w)
+
+		if w.OutputFile != nil {
+			path, err := filepath.Abs(w.OutputFile.Path)
+			if err != nil {
+				return nil, fmt.Errorf("conf: %s: %w", section.Name(), err)
+			}
+			if other, ok := outputFiles[path]; ok {
+				return nil, fmt.Errorf("conf: %s: output file %s is already written by %s", section.Name(), w.OutputFile.Path, other)
+			}
+			outputFiles[path] = section.Name()
+		}
+
+		pool := section.Key(CfgPool).MustString(defaultPool)
+		if pool != "" && (scheduler == nil || !scheduler.HasPool(pool)) {
+			return nil, fmt.Errorf("conf: %s: unknown pool %s", section.Name(), pool)
+		}
+
+		if scheduler != nil {
+			w.Executor = NewExecutorScheduled(scheduler, w.Name, pool, w.Executor, w.Logger)
+		}
+
+		after[section.Name()] = section.Key(CfgAfter).Strings(",")
+		triggers[section.Name()] = section.Key(CfgTrigger).Strings(",")
+	}
+
+	if err := LinkWatchers(watchers, after, triggers); err != nil {
+		return nil, fmt.Errorf("conf: %w", err)
 	}
 
 	return watchers, nil
@@ -0,0 +1,81 @@
+package pkg_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-ini/ini"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+// recordOptions returns a provider keeping the options given for each command.
+func recordOptions(opts map[string]pkg.ExecOptions) pkg.ExecutorProvider {
+	return func(name, commandTemplate string, o pkg.ExecOptions) (pkg.Executor, error) {
+		opts[commandTemplate] = o
+		return pkg.NewExecutorPrintPath(os.Stdout), nil
+	}
+}
+
+func TestWatchersFromConfEnv(t *testing.T) {
+	workdir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(workdir, ".env.test"), []byte("FROM_FILE=file\n"), 0600))
+
+	cfg, err := ini.Load([]byte(`
+env.SHARED = shared
+env_file = .env.test
+workdir = ` + workdir + `
+
+[frontend]
+command = frontend
+env.NODE_ENV = test
+env.COMBINED = ${SHARED}-${NODE_ENV}-${FROM_FILE}
+
+[backend]
+command = backend
+env.SHARED = ${SHARED}-overridden
+`))
+	require.NoError(t, err)
+
+	opts := make(map[string]pkg.ExecOptions)
+	_, err = pkg.WatchersFromConf(cfg, stderrLogger(t), recordOptions(opts))
+	require.NoError(t, err)
+
+	require.Equal(t, workdir, opts["frontend"].WorkDir)
+	require.Equal(t, []string{
+		"FROM_FILE=file",
+		"SHARED=shared",
+		"NODE_ENV=test",
+		"COMBINED=shared-test-file",
+	}, opts["frontend"].Env)
+
+	require.Equal(t, workdir, opts["backend"].WorkDir)
+	require.Equal(t, []string{"FROM_FILE=file", "SHARED=shared", "SHARED=shared-overridden"}, opts["backend"].Env)
+}
+
+func TestWatchersFromConfInvalidKeepsNoNotifier(t *testing.T) {
+	if _, err := os.ReadDir("/proc/self/fd"); err != nil {
+		t.Skip("open files cannot be listed")
+	}
+
+	open := func() int {
+		fds, err := os.ReadDir("/proc/self/fd")
+		require.NoError(t, err)
+		return len(fds)
+	}
+
+	before := open()
+	for _, conf := range []string{
+		"[build]\ncommand = true\noutput = bogus\n",
+		"[server]\ncommand = true\nmode = service\noutput = diff\n",
+	} {
+		cfg, err := ini.Load([]byte(conf))
+		require.NoError(t, err)
+
+		_, err = pkg.WatchersFromConf(cfg, stderrLogger(t), recordOptions(make(map[string]pkg.ExecOptions)))
+		require.Error(t, err)
+	}
+	require.Equal(t, before, open())
+}
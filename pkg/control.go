@@ -0,0 +1,76 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// ControlURL is the base URL of requests sent to the control socket, the
+// host is not resolved but must be accepted by the API.
+const ControlURL = "http://localhost"
+
+// ControlSocketPath returns the control socket of the project in dir,
+// $XDG_RUNTIME_DIR/watchngo-<hash of dir>.sock, or in a directory of the user
+// below the temporary directory when XDG_RUNTIME_DIR is not set.
+func ControlSocketPath(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("control socket: %w", err)
+	}
+
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		if runtimeDir, err = privateTempDir(); err != nil {
+			return "", fmt.Errorf("control socket: %w", err)
+		}
+	}
+
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(runtimeDir, "watchngo-"+hex.EncodeToString(sum[:])[:12]+".sock"), nil
+}
+
+// ListenControl opens the control socket, only readable by the user. A
+// socket left by an instance that did not stop cleanly is replaced, an
+// error is returned if another instance listens on it.
+func ListenControl(path string) (net.Listener, error) {
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("control socket: %s: another instance is running", path)
+	} else if !errors.Is(err, os.ErrNotExist) && !errors.Is(err, syscall.ECONNREFUSED) {
+		return nil, fmt.Errorf("control socket: %w", err)
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("control socket: %w", err)
+	}
+
+	ln, err := listenPrivate(path)
+	if err != nil {
+		return nil, fmt.Errorf("control socket: %w", err)
+	}
+
+	return ln, nil
+}
+
+// NewControlClient returns a client sending requests for ControlURL to the
+// API served on the control socket.
+func NewControlClient(path string) *http.Client {
+	dialer := net.Dialer{Timeout: time.Second * 5}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+}
@@ -0,0 +1,20 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package pkg
+
+import (
+	"net"
+	"os"
+)
+
+// privateTempDir returns the temporary directory, which belongs to the user.
+func privateTempDir() (string, error) {
+	return os.TempDir(), nil
+}
+
+// listenPrivate creates the socket, which is only accessible by the user
+// in its temporary directory.
+func listenPrivate(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
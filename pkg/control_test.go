@@ -0,0 +1,209 @@
+package pkg_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/go-ini/ini"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+func TestControlSocketPath(t *testing.T) {
+	defer os.Setenv("XDG_RUNTIME_DIR", os.Getenv("XDG_RUNTIME_DIR"))
+	require.NoError(t, os.Setenv("XDG_RUNTIME_DIR", "/run/user/1000"))
+
+	path, err := pkg.ControlSocketPath("/src/project")
+	require.NoError(t, err)
+	require.Regexp(t, `^/run/user/1000/watchngo-[0-9a-f]{12}\.sock$`, path)
+
+	other, err := pkg.ControlSocketPath("/src/other")
+	require.NoError(t, err)
+	require.NotEqual(t, path, other)
+}
+
+func TestControlSocketPathTempDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the temporary directory belongs to the user")
+	}
+
+	tmp := t.TempDir()
+	defer os.Setenv("XDG_RUNTIME_DIR", os.Getenv("XDG_RUNTIME_DIR"))
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	require.NoError(t, os.Unsetenv("XDG_RUNTIME_DIR"))
+	require.NoError(t, os.Setenv("TMPDIR", tmp))
+
+	path, err := pkg.ControlSocketPath("/src/project")
+	require.NoError(t, err)
+	dir := filepath.Join(tmp, fmt.Sprintf("watchngo-%d", os.Getuid()))
+	require.Equal(t, dir, filepath.Dir(path))
+
+	fi, err := os.Stat(dir)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0700), fi.Mode().Perm())
+
+	ln, err := pkg.ListenControl(path)
+	require.NoError(t, err)
+	fi, err = os.Stat(path)
+	require.NoError(t, err)
+	require.Zero(t, fi.Mode().Perm()&0077, "socket only accessible by the user")
+	require.NoError(t, ln.Close())
+
+	require.NoError(t, os.Chmod(dir, 0777))
+	_, err = pkg.ControlSocketPath("/src/project")
+	require.Error(t, err, "directory accessible by others")
+}
+
+func TestControlReload(t *testing.T) {
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "watchngo.ini")
+	socket := filepath.Join(dir, "control.sock")
+
+	write := func(content string) {
+		require.NoError(t, os.WriteFile(conf, []byte("silent = true\nmatch = "+dir+"\n"+content), 0644))
+	}
+	write("[first]\ncommand = true\n")
+
+	runner, err := pkg.NewRunner(func() ([]*pkg.Watcher, error) {
+		cfg, err := ini.Load(conf)
+		if err != nil {
+			return nil, err
+		}
+		return pkg.WatchersFromConf(cfg, stderrLogger(t), pkg.ExecutorFromName)
+	})
+	require.NoError(t, err)
+
+	// a socket left by a killed instance is replaced.
+	require.NoError(t, os.WriteFile(socket, nil, 0600))
+	ln, err := pkg.ListenControl(socket)
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() { _ = http.Serve(ln, pkg.NewAPI(runner, nil)) }()
+
+	_, err = pkg.ListenControl(socket)
+	require.Error(t, err, "another instance listens")
+
+	ran := make(chan struct{})
+	go func() {
+		runner.Run()
+		close(ran)
+	}()
+
+	client := pkg.NewControlClient(socket)
+	reload := func() (int, []pkg.WatcherInfo) {
+		resp, err := client.Post(pkg.ControlURL+"/reload", "application/json", nil)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var infos []pkg.WatcherInfo
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&infos))
+		}
+		return resp.StatusCode, infos
+	}
+
+	previous := runner.Watchers()
+	write("[first]\ncommand = true\n[second]\ncommand = true\n")
+	status, infos := reload()
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, infos, 2)
+	require.Equal(t, "second", infos[1].Name)
+	require.NotEqual(t, previous[0], runner.Watchers()[0])
+
+	write("[broken\n")
+	status, _ = reload()
+	require.Equal(t, http.StatusUnprocessableEntity, status)
+	require.Len(t, runner.Watchers(), 2, "watchers are kept")
+
+	for _, w := range runner.Watchers() {
+		w.Stop()
+	}
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second * 5):
+		t.Fatal("runner did not return once its watchers stopped")
+	}
+}
+
+func TestReloadResetsBreaker(t *testing.T) {
+	cfg := []byte("silent = true\n\n[flaky]\ncommand = false\nbreaker = 1\n")
+
+	runner, err := pkg.NewRunner(func() ([]*pkg.Watcher, error) {
+		cfg, err := ini.Load(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return pkg.WatchersFromConf(cfg, stderrLogger(t), pkg.ExecutorFromName)
+	})
+	require.NoError(t, err)
+
+	require.Error(t, runner.Watchers()[0].Trigger())
+	require.True(t, runner.Watchers()[0].Paused(), "breaker opened")
+
+	require.NoError(t, runner.Reload())
+	require.False(t, runner.Watchers()[0].Paused())
+	require.Zero(t, runner.Watchers()[0].Breaker.Failures())
+}
+
+func TestReloadStopsPooledService(t *testing.T) {
+	dir := t.TempDir()
+	starts := filepath.Join(dir, "starts")
+	logs := &syncBuffer{}
+	logger, err := pkg.NewLogger(logs, pkg.LogFormatLogfmt, pkg.LevelTrace)
+	require.NoError(t, err)
+
+	cfg := []byte(`
+pool.web = 1
+retry_backoff = 10ms..10ms
+
+[web]
+match = ` + dir + `
+filter = \.go$
+mode = service
+pool = web
+command = echo started >> ` + starts + ` && exec sleep 30
+`)
+
+	runner, err := pkg.NewRunner(func() ([]*pkg.Watcher, error) {
+		cfg, err := ini.Load(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return pkg.WatchersFromConf(cfg, logger, pkg.ExecutorFromName)
+	})
+	require.NoError(t, err)
+
+	ran := make(chan struct{})
+	go func() {
+		runner.Run()
+		close(ran)
+	}()
+	defer func() {
+		for _, w := range runner.Watchers() {
+			w.Stop()
+		}
+		<-ran
+	}()
+
+	started := func() string {
+		b, _ := os.ReadFile(starts)
+		return string(b)
+	}
+
+	require.Eventually(t, func() bool { return started() == "started\n" }, time.Second*5, time.Millisecond*10)
+	require.NoError(t, runner.Reload())
+	require.Eventually(t, func() bool { return started() == "started\nstarted\n" }, time.Second*5, time.Millisecond*10)
+
+	// the previous service was stopped, not restarted as if it crashed.
+	time.Sleep(time.Millisecond * 200)
+	require.Equal(t, "started\nstarted\n", started())
+	require.NotContains(t, logs.String(), "service exited")
+}
@@ -0,0 +1,45 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package pkg
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// privateTempDir returns $TMPDIR/watchngo-<uid>, created only accessible by
+// the user. Another user can create it first in a shared temporary
+// directory, so it is refused unless owned by the user with no access for
+// others.
+func privateTempDir() (string, error) {
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("watchngo-%d", os.Getuid()))
+	if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !fi.IsDir() || !ok || int(st.Uid) != os.Getuid() || fi.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("%s: must be a directory of the user with mode 0700", dir)
+	}
+
+	return dir, nil
+}
+
+// listenPrivate creates the socket without access for others, instead of
+// restricting it once others could already connect. The umask is the one of
+// the process, ListenControl is called before watchers create files.
+func listenPrivate(path string) (net.Listener, error) {
+	mask := syscall.Umask(0077)
+	defer syscall.Umask(mask)
+
+	return net.Listen("unix", path)
+}
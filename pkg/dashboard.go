@@ -0,0 +1,29 @@
+package pkg
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed dashboard.html
+var dashboardPage []byte
+
+// NewDashboard returns the handler of the web dashboard: the page on / and
+// the API under /api/. The page is self-contained and follows the watchers
+// through /api/events. Requests are restricted as the ones of the API.
+func NewDashboard(api http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/api/", http.StripPrefix("/api", api))
+	mux.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(rw, r)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		rw.Header().Set("Cache-Control", "no-cache")
+		_, _ = rw.Write(dashboardPage)
+	})
+
+	return guardRequest(mux)
+}
@@ -0,0 +1,76 @@
+package pkg_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-ini/ini"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+func TestDashboard(t *testing.T) {
+	cfg, err := ini.Load([]byte(`
+silent = true
+
+[build]
+filter = \.go$
+command = true
+`))
+	require.NoError(t, err)
+
+	watchers, err := pkg.WatchersFromConf(cfg, stderrLogger(t), pkg.ExecutorFromName)
+	require.NoError(t, err)
+
+	runner, err := pkg.NewRunner(func() ([]*pkg.Watcher, error) { return watchers, nil })
+	require.NoError(t, err)
+
+	server := httptest.NewServer(pkg.NewDashboard(pkg.NewAPI(runner, pkg.NewEventBus())))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/")
+	require.NoError(t, err)
+	page, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	require.Contains(t, string(page), `new EventSource("api/events")`)
+	require.NotRegexp(t, `(src|href)="https?:`, string(page), "no external assets")
+
+	resp, err = http.Get(server.URL + "/api/watchers")
+	require.NoError(t, err)
+	var infos []pkg.WatcherInfo
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&infos))
+	resp.Body.Close()
+	require.Len(t, infos, 1)
+	require.Equal(t, `\.go$`, infos[0].Filter)
+
+	resp, err = http.Get(server.URL + "/missing")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// the page of a rebound domain cannot be served, the API neither.
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/", nil)
+	require.NoError(t, err)
+	req.Host = "attacker.example:7778"
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// the page triggers watchers from the same origin.
+	req, err = http.NewRequest(http.MethodPost, server.URL+"/api/watchers/build/pause", nil)
+	require.NoError(t, err)
+	req.Header.Set("Origin", server.URL)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.True(t, watchers[0].Paused())
+}
@@ -0,0 +1,96 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LinkWatchers sets After and Triggers of each watcher from the names given
+// in after and triggers, indexed by watcher name. Watchers must form a
+// directed acyclic graph, an upstream watcher running before its
+// downstream ones.
+func LinkWatchers(watchers []*Watcher, after map[string][]string, triggers map[string][]string) error {
+	byName := make(map[string]*Watcher, len(watchers))
+	for _, w := range watchers {
+		byName[w.Name] = w
+	}
+
+	resolve := func(from string, names []string) ([]*Watcher, error) {
+		resolved := make([]*Watcher, 0, len(names))
+		for _, name := range names {
+			w, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("watcher %s: unknown watcher %s", from, name)
+			}
+			resolved = append(resolved, w)
+		}
+		return resolved, nil
+	}
+
+	// downstream watchers of each watcher, to look for cycles.
+	graph := make(map[string][]string)
+
+	for _, w := range watchers {
+		var err error
+		if w.After, err = resolve(w.Name, after[w.Name]); err != nil {
+			return err
+		}
+
+		if w.Triggers, err = resolve(w.Name, triggers[w.Name]); err != nil {
+			return err
+		}
+
+		for _, upstream := range w.After {
+			graph[upstream.Name] = append(graph[upstream.Name], w.Name)
+		}
+
+		for _, downstream := range w.Triggers {
+			graph[w.Name] = append(graph[w.Name], downstream.Name)
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int)
+	path := make([]string, 0)
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			for i := range path {
+				if path[i] == name {
+					return fmt.Errorf("dependency cycle: %s", strings.Join(append(path[i:], name), " -> "))
+				}
+			}
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+
+		for _, next := range graph[name] {
+			if err := visit(next); err != nil {
+				return err
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[name] = visited
+
+		return nil
+	}
+
+	for _, w := range watchers {
+		if err := visit(w.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
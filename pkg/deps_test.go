@@ -0,0 +1,139 @@
+package pkg_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-ini/ini"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+func watchersFromString(t *testing.T, conf string) ([]*pkg.Watcher, error) {
+	cfg, err := ini.Load([]byte(conf))
+	require.NoError(t, err)
+	return pkg.WatchersFromConf(cfg, stderrLogger(t), pkg.ExecutorFromName)
+}
+
+func TestLinkWatchers(t *testing.T) {
+	watchers, err := watchersFromString(t, `
+[generate]
+command = true
+trigger = test
+
+[build]
+command = true
+after = generate
+trigger = test
+
+[test]
+command = true
+`)
+	require.NoError(t, err)
+	require.Equal(t, []*pkg.Watcher{watchers[0]}, watchers[1].After)
+	require.Equal(t, []*pkg.Watcher{watchers[2]}, watchers[1].Triggers)
+
+	_, err = watchersFromString(t, `
+[build]
+command = true
+after = unknown
+`)
+	require.EqualError(t, err, "conf: watcher build: unknown watcher unknown")
+
+	_, err = watchersFromString(t, `
+[generate]
+command = true
+after = test
+
+[build]
+command = true
+after = generate
+
+[test]
+command = true
+after = build
+`)
+	require.EqualError(t, err, "conf: dependency cycle: generate -> build -> test -> generate")
+
+	_, err = watchersFromString(t, `
+[build]
+command = true
+trigger = build
+`)
+	require.EqualError(t, err, "conf: dependency cycle: build -> build")
+}
+
+func TestTriggerDownstream(t *testing.T) {
+	workdir := t.TempDir()
+
+	watchers, err := watchersFromString(t, `
+workdir = `+workdir+`
+match = `+workdir+`
+filter = .*\.proto
+silent = true
+
+[generate]
+command = true
+trigger = test
+
+[test]
+command = echo %event.file > triggered
+`)
+	require.NoError(t, err)
+
+	go func() { _ = watchers[1].Work() }()
+	defer watchers[1].Stop()
+	time.Sleep(time.Millisecond * 100)
+
+	require.NoError(t, watchers[0].Trigger("api.proto"))
+
+	require.Eventually(t, func() bool {
+		b, err := os.ReadFile(filepath.Join(workdir, "triggered"))
+		return err == nil && string(b) == "api.proto\n"
+	}, time.Second*2, time.Millisecond*50)
+}
+
+func TestAfterWaitsForUpstream(t *testing.T) {
+	workdir := t.TempDir()
+	src := filepath.Join(workdir, "src")
+	require.NoError(t, os.Mkdir(src, 0755))
+
+	watchers, err := watchersFromString(t, `
+workdir = `+workdir+`
+silent = true
+
+[generate]
+match = `+src+`
+filter = .*\.proto
+command = sleep 0.3 && echo generate >> log
+
+[build]
+match = `+src+`
+filter = .*\.proto
+command = echo build >> log
+after = generate
+`)
+	require.NoError(t, err)
+
+	for _, w := range watchers {
+		go func(w *pkg.Watcher) { _ = w.Work() }(w)
+		defer w.Stop()
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	read := func() string {
+		b, _ := os.ReadFile(filepath.Join(workdir, "log"))
+		return string(b)
+	}
+
+	// both watchers receive the change, the downstream one waits for the
+	// upstream run.
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a.proto"), nil, 0644))
+
+	require.Eventually(t, func() bool { return strings.Count(read(), "\n") >= 2 }, time.Second*5, time.Millisecond*50)
+	require.Equal(t, "generate\nbuild\n", read())
+}
@@ -0,0 +1,212 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DiffMaxEdits bounds the work done by LineDiff, outputs differing by more
+// lines are considered entirely different. The memory used grows with its
+// square.
+const DiffMaxEdits = 1000
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// diffLines returns the shortest edit script from a to b, using the Myers
+// algorithm on the lines between their common prefix and suffix. ok is
+// false when more than maxEdits edits are needed.
+func diffLines(a, b []string, maxEdits int) (ops []diffOp, ok bool) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	middle, ok := myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], maxEdits)
+	if !ok {
+		return nil, false
+	}
+
+	ops = make([]diffOp, 0, prefix+len(middle)+suffix)
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{kind: ' ', line: line})
+	}
+	ops = append(ops, middle...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{kind: ' ', line: line})
+	}
+
+	return ops, true
+}
+
+func myersDiff(a, b []string, maxEdits int) (ops []diffOp, ok bool) {
+	n, m := len(a), len(b)
+	max := n + m
+	if max > maxEdits {
+		max = maxEdits
+	}
+
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	// trace holds, for each d, the furthest x of the diagonals -d-1 to d+1
+	// reached with d-1 edits: the only ones the backtrack reads.
+	trace := make([][]int, 0)
+
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrackDiff(a, b, trace), true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func backtrackDiff(a, b []string, trace [][]int) []diffOp {
+	x, y := len(a), len(b)
+	reversed := make([]diffOp, 0, x+y)
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v, offset := trace[d], d+1
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, diffOp{kind: ' ', line: a[x-1]})
+			x--
+			y--
+		}
+
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, diffOp{kind: '+', line: b[prevY]})
+			} else {
+				reversed = append(reversed, diffOp{kind: '-', line: a[prevX]})
+			}
+		}
+
+		x, y = prevX, prevY
+	}
+
+	ops := make([]diffOp, len(reversed))
+	for i, op := range reversed {
+		ops[len(reversed)-1-i] = op
+	}
+
+	return ops
+}
+
+// LineDiff returns a unified diff from a to b with the given number of
+// context lines, and the number of added and removed lines. The diff is
+// empty when both are equal. ok is false when they differ by more than
+// DiffMaxEdits lines.
+func LineDiff(a, b []string, context int) (diff string, added, removed int, ok bool) {
+	ops, ok := diffLines(a, b, DiffMaxEdits)
+	if !ok {
+		return "", 0, 0, false
+	}
+
+	// line index in a and b before each op.
+	aIdx := make([]int, len(ops)+1)
+	bIdx := make([]int, len(ops)+1)
+	for i, op := range ops {
+		aIdx[i+1], bIdx[i+1] = aIdx[i], bIdx[i]
+		switch op.kind {
+		case ' ':
+			aIdx[i+1]++
+			bIdx[i+1]++
+		case '-':
+			aIdx[i+1]++
+			removed++
+		case '+':
+			bIdx[i+1]++
+			added++
+		}
+	}
+
+	out := strings.Builder{}
+	prevEnd := 0
+
+	for i := 0; i < len(ops); {
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		lastChange := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				lastChange = j
+			} else if j-lastChange > 2*context {
+				break
+			}
+		}
+
+		start := i - context
+		if start < prevEnd {
+			start = prevEnd
+		}
+
+		end := lastChange + context + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		aCount, bCount := aIdx[end]-aIdx[start], bIdx[end]-bIdx[start]
+		aStart, bStart := aIdx[start], bIdx[start]
+		if aCount > 0 {
+			aStart++
+		}
+		if bCount > 0 {
+			bStart++
+		}
+
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+		for _, op := range ops[start:end] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			out.WriteByte('\n')
+		}
+
+		prevEnd = end
+		i = end
+	}
+
+	return out.String(), added, removed, true
+}
@@ -0,0 +1,105 @@
+package pkg_test
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+func TestLineDiff(t *testing.T) {
+	a := strings.Split("1 2 3 4 5 6 7 8 9 10 11 12", " ")
+	b := strings.Split("1 2 3 4 five 6 7 8 9 10 11 12 13", " ")
+
+	diff, added, removed, ok := pkg.LineDiff(a, b, 2)
+	require.True(t, ok)
+	require.Equal(t, 2, added)
+	require.Equal(t, 1, removed)
+	require.Equal(t, `@@ -3,5 +3,5 @@
+ 3
+ 4
+-5
++five
+ 6
+ 7
+@@ -11,2 +11,3 @@
+ 11
+ 12
++13
+`, diff)
+
+	diff, added, removed, ok = pkg.LineDiff(a, a, 2)
+	require.True(t, ok)
+	require.Empty(t, diff)
+	require.Zero(t, added+removed)
+
+	diff, added, removed, ok = pkg.LineDiff(nil, []string{"new"}, 3)
+	require.True(t, ok)
+	require.Equal(t, "@@ -0,0 +1,1 @@\n+new\n", diff)
+	require.Equal(t, 1, added)
+	require.Zero(t, removed)
+}
+
+func TestLineDiffLarge(t *testing.T) {
+	lines := func(n int, prefix string) []string {
+		l := make([]string, n)
+		for i := range l {
+			l[i] = fmt.Sprintf("%s%d", prefix, i)
+		}
+		return l
+	}
+
+	// a few changes in a long output only cost the changed lines.
+	a := lines(20000, "line ")
+	b := append([]string(nil), a...)
+	b[100], b[15000] = "changed", "changed"
+	_, added, removed, ok := pkg.LineDiff(a, b, 3)
+	require.True(t, ok)
+	require.Equal(t, 2, added)
+	require.Equal(t, 2, removed)
+
+	_, _, _, ok = pkg.LineDiff(a, lines(20000, "other "), 3)
+	require.False(t, ok, "more than DiffMaxEdits changes")
+
+	// the edits are the shortest ones.
+	for i := 0; i < 200; i++ {
+		a, b := make([]string, rand.Intn(12)), make([]string, rand.Intn(12))
+		for j := range a {
+			a[j] = strconv.Itoa(rand.Intn(3))
+		}
+		for j := range b {
+			b[j] = strconv.Itoa(rand.Intn(3))
+		}
+
+		diff, added, removed, ok := pkg.LineDiff(a, b, len(a)+len(b))
+		require.True(t, ok)
+		lcs := longestCommonSubsequence(a, b)
+		require.Equal(t, len(b)-lcs, added, diff)
+		require.Equal(t, len(a)-lcs, removed, diff)
+	}
+}
+
+func longestCommonSubsequence(a, b []string) int {
+	l := make([][]int, len(a)+1)
+	for i := range l {
+		l[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				l[i][j] = l[i+1][j+1] + 1
+			case l[i+1][j] > l[i][j+1]:
+				l[i][j] = l[i+1][j]
+			default:
+				l[i][j] = l[i][j+1]
+			}
+		}
+	}
+	return l[0][0]
+}
@@ -0,0 +1,76 @@
+package pkg
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ExpandEnv replaces ${VAR} and $VAR in value. Variables are looked up in env,
+// a list of KEY=VALUE entries where the last definition wins, then in the
+// environment of watchngo itself.
+func ExpandEnv(value string, env []string) string {
+	return os.Expand(value, func(name string) string {
+		for i := len(env) - 1; i >= 0; i-- {
+			if kv := strings.SplitN(env[i], "=", 2); len(kv) == 2 && kv[0] == name {
+				return kv[1]
+			}
+		}
+		return os.Getenv(name)
+	})
+}
+
+// ParseEnvFile reads a dotenv-like file and appends its variables to env as
+// KEY=VALUE entries.
+//
+// Empty lines and lines starting with # are ignored, an optional "export "
+// prefix is accepted. Values can be quoted: single quoted values are taken
+// as-is, others are expanded with ExpandEnv against the variables defined
+// so far.
+func ParseEnvFile(path string, env []string) ([]string, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return env, fmt.Errorf("env file: %w", err)
+	}
+	defer fh.Close()
+
+	scanner := bufio.NewScanner(fh)
+	lineno := 0
+
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return env, fmt.Errorf("env file: %s:%d: expected KEY=VALUE", path, lineno)
+		}
+
+		key := strings.TrimSpace(kv[0])
+		value := strings.TrimSpace(kv[1])
+
+		switch {
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			value = ExpandEnv(value[1:len(value)-1], env)
+		default:
+			value = ExpandEnv(value, env)
+		}
+
+		env = append(env, key+"="+value)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return env, fmt.Errorf("env file: %s: %w", path, err)
+	}
+
+	return env, nil
+}
@@ -0,0 +1,40 @@
+package pkg_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+func TestExpandEnv(t *testing.T) {
+	require.NoError(t, os.Setenv("WATCHNGO_TEST_HOME", "/home/test"))
+	defer os.Unsetenv("WATCHNGO_TEST_HOME")
+
+	env := []string{"A=1", "B=2", "A=3"}
+
+	require.Equal(t, "3-2", pkg.ExpandEnv("${A}-$B", env))
+	require.Equal(t, "/home/test/bin", pkg.ExpandEnv("${WATCHNGO_TEST_HOME}/bin", env))
+	require.Equal(t, "", pkg.ExpandEnv("${WATCHNGO_TEST_UNDEFINED}", env))
+}
+
+func TestParseEnvFile(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	require.NoError(t, os.WriteFile(envFile, []byte(`
+# comment
+export A=1
+B = "${A}2"
+C='${A}'
+`), 0600))
+
+	env, err := pkg.ParseEnvFile(envFile, []string{"Z=0"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"Z=0", "A=1", "B=12", "C=${A}"}, env)
+
+	require.NoError(t, os.WriteFile(envFile, []byte("NOVALUE\n"), 0600))
+	_, err = pkg.ParseEnvFile(envFile, nil)
+	require.Error(t, err)
+}
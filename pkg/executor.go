@@ -6,11 +6,12 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"os/exec"
+	"runtime"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Executor provides a minimal workflow to run commands.
@@ -21,6 +22,37 @@ type Executor interface {
 	Exec(event NotificationEvent, eventFile string) error
 }
 
+// ExecOptions are applied to every command started by an executor.
+type ExecOptions struct {
+	// WorkDir is the directory commands are run in. Defaults to the
+	// current directory of watchngo.
+	WorkDir string
+	// Env is a list of KEY=VALUE entries added to the environment of
+	// watchngo, the last definition of a key wins.
+	Env []string
+	// Shell and ShellArgs are used by the UnixShell executor, defaulting to
+	// DefaultShell and DefaultShellArgs.
+	Shell     string
+	ShellArgs []string
+	// Timeout stops the command when it runs for longer, 0 disables it.
+	// The process group of the command is sent SIGTERM, then SIGKILL if it
+	// is still running after KillGrace, or DefaultKillGrace if not set.
+	Timeout   time.Duration
+	KillGrace time.Duration
+	// Limits restrict the resources of commands, on Linux.
+	Limits Limits
+	// Logger receives warnings of executors, it can be nil.
+	Logger Logger
+	// Output and ErrOutput receive the standard and error outputs of
+	// commands. Default to os.Stdout and os.Stderr.
+	Output    io.Writer
+	ErrOutput io.Writer
+}
+
+// DefaultKillGrace is the delay between SIGTERM and SIGKILL when a command
+// times out.
+const DefaultKillGrace = time.Second * 10
+
 // MakeCommand based on a template. See Notification for available strings.
 // %event.file is replaced with the full path of a file that triggered the run.
 // %event.op is replace with one of the supported operation found in Notification type.
@@ -49,28 +81,85 @@ func (e *printExec) Exec(event NotificationEvent, eventFile string) error {
 	return err
 }
 
+// Default shell used by the UnixShell executor.
+const (
+	DefaultShell     = "/bin/sh"
+	DefaultShellArgs = "-c"
+)
+
 // NewExecutorUnixShell returns an executor that will run your command through
 // /bin/sh -c "<command>". Your command will be quoted before to avoid any
 // problems.
+//
+// It panics if /bin/sh is not available, use NewExecutorShell to get an error
+// instead.
 func NewExecutorUnixShell(output io.Writer, commandTemplate string) Executor {
-	if _, err := os.Stat("/bin/sh"); err != nil {
-		panic(fmt.Errorf("cannot use UnixShell executor: %v", err))
+	e, err := NewExecutorShell(output, commandTemplate, ExecOptions{})
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// NewExecutorShell returns an executor that will run your command through
+// the shell set in opts, as in <shell> <shell args...> "<command>".
+// The shell defaults to DefaultShell with DefaultShellArgs, it can be any
+// shell accepting a command string as its last argument: bash, zsh, fish...
+func NewExecutorShell(output io.Writer, commandTemplate string, opts ExecOptions) (Executor, error) {
+	shell := opts.Shell
+	shellArgs := opts.ShellArgs
+
+	if shell == "" {
+		shell = DefaultShell
+	}
+
+	if shellArgs == nil {
+		shellArgs = strings.Fields(DefaultShellArgs)
+	}
+
+	shellPath, err := exec.LookPath(shell)
+	if err != nil {
+		return nil, fmt.Errorf("cannot use shell executor: %w", err)
 	}
 
 	return &unixShellExec{
-		rawExec:         NewExecutorRaw(output, "").(*rawExec),
+		rawExec:         NewExecutorRaw(output, "", opts).(*rawExec),
 		commandTemplate: commandTemplate,
+		shell:           append([]string{shellPath}, shellArgs...),
+	}, nil
+}
+
+// NewExecutorPTY returns an executor running your command through the shell,
+// like NewExecutorShell, in a pseudo-terminal. Commands see a terminal, sized
+// as the one watchngo runs in, so they keep colors and progress bars.
+// Standard and error outputs are both written to output.
+//
+// Only supported on Linux.
+func NewExecutorPTY(output io.Writer, commandTemplate string, opts ExecOptions) (Executor, error) {
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("cannot use pty executor on %s", runtime.GOOS)
+	}
+
+	e, err := NewExecutorShell(output, commandTemplate, opts)
+	if err != nil {
+		return nil, err
 	}
+
+	e.(*unixShellExec).rawExec.pty = true
+	return e, nil
 }
 
 type unixShellExec struct {
 	rawExec         *rawExec
 	commandTemplate string
+	// shell holds the shell program and its arguments, the command comes last.
+	shell []string
 }
 
 func (e *unixShellExec) Exec(event NotificationEvent, eventFile string) error {
 	cmd := MakeCommand(e.commandTemplate, event, eventFile)
-	return e.rawExec.ExecCommand([]string{"/bin/sh", "-c", cmd}...)
+	params := append(append([]string{}, e.shell...), cmd)
+	return e.rawExec.ExecCommand(params...)
 }
 
 func (e *unixShellExec) Running() bool {
@@ -78,15 +167,24 @@ func (e *unixShellExec) Running() bool {
 }
 
 // NewExecutorRaw will run your command without shell. Used by the UnixShell executor.
-func NewExecutorRaw(output io.Writer, commandTemplate string) Executor {
-	return &rawExec{output: output, commandTemplate: commandTemplate}
+func NewExecutorRaw(output io.Writer, commandTemplate string, opts ExecOptions) Executor {
+	errOutput := opts.ErrOutput
+	if errOutput == nil {
+		errOutput = os.Stderr
+	}
+
+	return &rawExec{output: output, errOutput: errOutput, commandTemplate: commandTemplate, opts: opts}
 }
 
 type rawExec struct {
 	commandTemplate string
+	opts            ExecOptions
 	lock            sync.RWMutex
 	executing       bool
 	output          io.Writer
+	errOutput       io.Writer
+	// pty runs commands in a pseudo-terminal.
+	pty bool
 }
 
 func (e *rawExec) setExecuting(on bool) {
@@ -105,46 +203,155 @@ func (e *rawExec) ExecCommand(params ...string) error {
 	e.setExecuting(true)
 	defer e.setExecuting(false)
 
-	rp, wp := io.Pipe()
+	if e.pty {
+		return e.execPTY(params...)
+	}
+
+	rpOut, wpOut := io.Pipe()
+	rpErr, wpErr := io.Pipe()
 	var cmd *exec.Cmd
 	var execError error
 
 	cmd = exec.Command(params[0], params[1:]...)
-	cmd.Stdout = wp
-	cmd.Stderr = wp
+	cmd.Dir = e.opts.WorkDir
+	if len(e.opts.Env) > 0 {
+		cmd.Env = append(os.Environ(), e.opts.Env...)
+	}
+	cmd.Stdout = wpOut
+	cmd.Stderr = wpErr
+	setProcessGroup(cmd)
 
 	execFinished := make(chan bool, 1)
 
 	go func() {
-		if err := cmd.Run(); err != nil {
+		if err := e.run(cmd, nil); err != nil {
 			execError = err
 		}
-		wp.Close()
+		wpOut.Close()
+		wpErr.Close()
 		execFinished <- true
 	}()
 
-	reader := bufio.NewReader(rp)
+	stderrCopied := make(chan bool, 1)
+
+	go func() {
+		copyLines(e.errOutput, rpErr)
+		stderrCopied <- true
+	}()
+
+	copyLines(e.output, rpOut)
+
+	<-stderrCopied
+	<-execFinished
+
+	return execError
+}
+
+func (e *rawExec) execPTY(params ...string) error {
+	cmd := exec.Command(params[0], params[1:]...)
+	cmd.Dir = e.opts.WorkDir
+	if len(e.opts.Env) > 0 {
+		cmd.Env = append(os.Environ(), e.opts.Env...)
+	}
+
+	master, slave, stop, err := ptyCommand(cmd)
+	if err != nil {
+		return err
+	}
+	defer master.Close()
+	defer stop()
+
+	var execError error
+	execFinished := make(chan bool, 1)
+
+	go func() {
+		// reading the master fails once no process has the slave open, so
+		// watchngo must not keep it once the command started.
+		execError = e.run(cmd, func() { slave.Close() })
+		// the slave is still open if the command did not start.
+		slave.Close()
+		execFinished <- true
+	}()
+
+	copyLines(e.output, master)
+	<-execFinished
+
+	return execError
+}
+
+// copyLines writes to dst line by line, so outputs of commands running at
+// the same time are not mixed in the middle of a line.
+func copyLines(dst io.Writer, src io.Reader) {
+	reader := bufio.NewReader(src)
 
 	for {
 		b, err := reader.ReadBytes('\n')
 
 		if len(b) > 0 {
-			e.output.Write(b)
+			dst.Write(b)
 		}
 
 		if err != nil {
 			break
 		}
 	}
+}
 
-	if reader.Buffered() > 0 {
-		b, _ := ioutil.ReadAll(reader)
-		e.output.Write(b)
+// run starts the command with its limits and waits for it. started can be
+// nil, it is called once the command started.
+func (e *rawExec) run(cmd *exec.Cmd, started func()) error {
+	limited, err := prepareLimits(cmd, e.opts.Limits, e.opts.Logger)
+	if err != nil {
+		return err
 	}
 
-	<-execFinished
+	if err := cmd.Start(); err != nil {
+		return limited(err)
+	}
 
-	return execError
+	trackProcess(cmd)
+	defer untrackProcess(cmd)
+
+	if started != nil {
+		started()
+	}
+
+	return limited(e.wait(cmd))
+}
+
+// wait for the command, enforcing the timeout.
+func (e *rawExec) wait(cmd *exec.Cmd) error {
+	if e.opts.Timeout <= 0 {
+		return cmd.Wait()
+	}
+
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- cmd.Wait() }()
+
+	timeout := time.NewTimer(e.opts.Timeout)
+	defer timeout.Stop()
+
+	select {
+	case err := <-waitErr:
+		return err
+	case <-timeout.C:
+	}
+
+	grace := e.opts.KillGrace
+	if grace <= 0 {
+		grace = DefaultKillGrace
+	}
+
+	_ = terminateProcessGroup(cmd)
+
+	select {
+	case <-waitErr:
+	case <-time.After(grace):
+		_ = killProcessGroup(cmd)
+		<-waitErr
+	}
+
+	return fmt.Errorf("%w after %s", ErrTimeout, e.opts.Timeout)
 }
 
 func (e *rawExec) Exec(event NotificationEvent, eventFile string) error {
@@ -2,6 +2,7 @@ package pkg_test
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 	"time"
 
@@ -29,3 +30,35 @@ func TestUnixShellExec(t *testing.T) {
 	time.Sleep(time.Millisecond * 1000)
 	require.False(t, exec.Running())
 }
+
+func TestShellExec(t *testing.T) {
+	out := bytes.Buffer{}
+
+	exec, err := pkg.NewExecutorShell(&out, "false | echo %event.file", pkg.ExecOptions{
+		Shell:     "bash",
+		ShellArgs: []string{"-euo", "pipefail", "-c"},
+	})
+	require.NoError(t, err)
+	require.Error(t, exec.Exec(pkg.NotificationEvent{}, "piped"))
+	require.Equal(t, "piped\n", out.String())
+
+	_, err = pkg.ExecutorFromName(pkg.ExecutorUnixShell, "true", pkg.ExecOptions{Shell: "/nonexistent/shell"})
+	require.Error(t, err)
+}
+
+func TestShellExecTimeout(t *testing.T) {
+	out := bytes.Buffer{}
+
+	// the shell and its children ignore SIGTERM, they must be killed after the grace delay.
+	exec, err := pkg.NewExecutorShell(&out, "trap '' TERM; sleep 5 & sleep 5; wait", pkg.ExecOptions{
+		Timeout:   time.Millisecond * 200,
+		KillGrace: time.Millisecond * 200,
+	})
+	require.NoError(t, err)
+
+	start := time.Now()
+	err = exec.Exec(pkg.NotificationEvent{}, "none")
+	require.True(t, errors.Is(err, pkg.ErrTimeout), "timeout error: %v", err)
+	require.Less(t, int64(time.Since(start)), int64(time.Second*2))
+	require.False(t, exec.Running())
+}
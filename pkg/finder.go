@@ -4,7 +4,6 @@ package pkg
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -26,7 +25,6 @@ type walkRec struct {
 func (w *walkRec) walkRecursive(file string, info os.FileInfo, walkErr error) error {
 	if walkErr != nil {
 		if strings.Contains(walkErr.Error(), "permission denied") {
-			log.Printf("skipped: %v", walkErr)
 			w.Exclude = append(w.Exclude, file)
 			return nil
 		}
@@ -71,6 +69,8 @@ func FindGlob(pattern string, matches []string) ([]string, error) {
 
 type LocalFinder struct {
 	Match string
+	// Logger is warned about skipped directories, it can be nil.
+	Logger Logger
 }
 
 func (l LocalFinder) Find() (*FinderResults, error) {
@@ -78,10 +78,17 @@ func (l LocalFinder) Find() (*FinderResults, error) {
 	var fr FinderResults
 
 	if err == nil && matchstat.IsDir() {
-		fr.Locations, _, err = FindRecursive(l.Match)
+		var excludes []string
+		fr.Locations, excludes, err = FindRecursive(l.Match)
 		if err != nil {
 			return nil, fmt.Errorf("find: %w", err)
 		}
+
+		for _, exclude := range excludes {
+			if l.Logger != nil {
+				l.Logger.Warn("skipped: permission denied", F(FieldPath, exclude))
+			}
+		}
 	} else if err == nil && !matchstat.IsDir() {
 		fr.Locations = append(fr.Locations, l.Match)
 	} else if err != nil {
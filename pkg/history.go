@@ -0,0 +1,369 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Files kept in the state directory of a project.
+const (
+	DefaultStateDir = ".watchngo"
+	HistoryFile     = "history.jsonl"
+	StatusFile      = "status.json"
+)
+
+// HistoryMaxRuns is the number of runs kept by a compaction, which happens
+// once the history holds twice as many.
+const HistoryMaxRuns = 1000
+
+// HistoryOutputLines is the number of output lines kept with each run.
+const HistoryOutputLines = 20
+
+// Causes of runs.
+const (
+	CauseEvents  = "events"
+	CauseManual  = "manual"
+	CauseStart   = "start"
+	CauseRestart = "restart"
+	CauseWatcher = "watcher:"
+)
+
+// RunEvent is a file change that caused a run.
+type RunEvent struct {
+	Path string `json:"path"`
+	Op   string `json:"op"`
+}
+
+// RunRecord describes a finished run.
+type RunRecord struct {
+	ID      int64  `json:"id"`
+	Watcher string `json:"watcher"`
+	// Cause is CauseEvents, CauseManual, CauseStart, CauseRestart, or CauseWatcher
+	// followed by the name of the upstream watcher.
+	Cause    string        `json:"cause"`
+	Events   []RunEvent    `json:"events,omitempty"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	ExitCode int           `json:"exit_code"`
+	Error    string        `json:"error,omitempty"`
+	// Output holds the last HistoryOutputLines lines of output.
+	Output string `json:"output,omitempty"`
+}
+
+// lastRunID is shared by watchers, so run ids are unique in a project once
+// the history is opened.
+var lastRunID int64
+
+func nextRunID() int64 {
+	return atomic.AddInt64(&lastRunID, 1)
+}
+
+// WatcherStatus is the state of a watcher in the status file.
+type WatcherStatus struct {
+	Name    string     `json:"name"`
+	State   string     `json:"state"`
+	LastRun *RunRecord `json:"last_run,omitempty"`
+}
+
+// Status is the content of the status file.
+type Status struct {
+	PID      int             `json:"pid"`
+	Updated  time.Time       `json:"updated"`
+	Watchers []WatcherStatus `json:"watchers"`
+}
+
+// History appends finished runs to the history file of a state directory,
+// and keeps its status file up to date.
+type History struct {
+	Path       string
+	StatusPath string
+
+	lock     sync.Mutex
+	runs     int
+	watchers []*Watcher
+}
+
+// OpenHistory creates the state directory if needed and reads the history
+// to continue its run ids.
+func OpenHistory(dir string) (*History, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("history: %w", err)
+	}
+
+	h := &History{
+		Path:       filepath.Join(dir, HistoryFile),
+		StatusPath: filepath.Join(dir, StatusFile),
+	}
+
+	records, err := ReadHistory(h.Path, 0)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err := terminateLastLine(h.Path); err != nil {
+		return nil, fmt.Errorf("history: %w", err)
+	}
+
+	h.runs = len(records)
+	for _, r := range records {
+		for last := atomic.LoadInt64(&lastRunID); r.ID > last; last = atomic.LoadInt64(&lastRunID) {
+			if atomic.CompareAndSwapInt64(&lastRunID, last, r.ID) {
+				break
+			}
+		}
+	}
+
+	return h, nil
+}
+
+// Watch records runs of the watchers and writes their status. Changes in
+// the state directory are ignored by the watchers.
+func (h *History) Watch(watchers []*Watcher) error {
+	h.lock.Lock()
+	h.watchers = watchers
+	h.lock.Unlock()
+
+	dir, err := filepath.Abs(filepath.Dir(h.Path))
+	if err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+
+	for _, w := range watchers {
+		w.History = h
+		w.Ignore = append(w.Ignore, dir)
+	}
+
+	return h.WriteStatus()
+}
+
+// Append a run to the history, compacting it when needed, then writes
+// the status.
+func (h *History) Append(r RunRecord) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+
+	h.lock.Lock()
+	err = h.append(append(line, '\n'))
+	h.lock.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return h.WriteStatus()
+}
+
+func (h *History) append(line []byte) error {
+	fh, err := os.OpenFile(h.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+
+	if _, err := fh.Write(line); err != nil {
+		fh.Close()
+		return fmt.Errorf("history: %w", err)
+	}
+
+	if err := fh.Close(); err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+
+	if h.runs++; h.runs < 2*HistoryMaxRuns {
+		return nil
+	}
+
+	records, err := ReadHistory(h.Path, HistoryMaxRuns)
+	if err != nil {
+		return err
+	}
+
+	compacted := bytes.Buffer{}
+	for _, r := range records {
+		b, _ := json.Marshal(r)
+		compacted.Write(append(b, '\n'))
+	}
+
+	if err := writeFile(h.Path, compacted.Bytes()); err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+
+	h.runs = len(records)
+	return nil
+}
+
+// terminateLastLine ends the file with a new line, so a line partially
+// written by an interrupted append is not joined to the next one.
+func terminateLastLine(path string) error {
+	fh, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0644)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	info, err := fh.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+
+	last := make([]byte, 1)
+	if _, err := fh.ReadAt(last, info.Size()-1); err != nil {
+		return err
+	}
+
+	if last[0] != '\n' {
+		_, err = fh.Write([]byte{'\n'})
+	}
+
+	return err
+}
+
+// WriteStatus replaces the status file with the state of the watchers. The
+// states are read while holding the lock, so a concurrent call cannot
+// replace the file with older ones.
+func (h *History) WriteStatus() error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	status := Status{PID: os.Getpid(), Updated: time.Now(), Watchers: make([]WatcherStatus, 0, len(h.watchers))}
+	for _, w := range h.watchers {
+		state := w.State()
+		status.Watchers = append(status.Watchers, WatcherStatus{Name: w.Name, State: state.State, LastRun: state.LastRun})
+	}
+
+	b, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return fmt.Errorf("status: %w", err)
+	}
+
+	if err := writeFile(h.StatusPath, append(b, '\n')); err != nil {
+		return fmt.Errorf("status: %w", err)
+	}
+
+	return nil
+}
+
+// ReadHistory returns the last runs of a history file, all of them if last
+// is 0. Lines that cannot be read, like one partially written, are skipped.
+func ReadHistory(path string, last int) ([]RunRecord, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	records := make([]RunRecord, 0)
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		var r RunRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+
+		records = append(records, r)
+		if last > 0 && len(records) > 2*last {
+			records = append(records[:0], records[len(records)-last:]...)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("history: %w", err)
+	}
+
+	if last > 0 && len(records) > last {
+		records = records[len(records)-last:]
+	}
+
+	return records, nil
+}
+
+// ReadStatus reads a status file.
+func ReadStatus(path string) (Status, error) {
+	var status Status
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return status, err
+	}
+
+	if err := json.Unmarshal(b, &status); err != nil {
+		return status, fmt.Errorf("status: %w", err)
+	}
+
+	return status, nil
+}
+
+// tailBuffer keeps the last lines written to it.
+type tailBuffer struct {
+	lock    sync.Mutex
+	max     int
+	lines   []string
+	partial []byte
+}
+
+// tailLineMax truncates long lines, like progress bars.
+const tailLineMax = 512
+
+func newTailBuffer(max int) *tailBuffer {
+	return &tailBuffer{max: max}
+}
+
+func (t *tailBuffer) add(line []byte) {
+	if len(line) > tailLineMax {
+		line = append(line[:tailLineMax:tailLineMax], "..."...)
+	}
+
+	t.lines = append(t.lines, string(line))
+	if len(t.lines) > t.max {
+		t.lines = t.lines[len(t.lines)-t.max:]
+	}
+}
+
+func (t *tailBuffer) Write(b []byte) (int, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	data := append(t.partial, b...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		t.add(data[:i])
+		data = data[i+1:]
+	}
+
+	if len(data) > tailLineMax {
+		t.add(data)
+		data = nil
+	}
+	t.partial = append([]byte(nil), data...)
+
+	return len(b), nil
+}
+
+// String returns the lines kept, the last one may be partial.
+func (t *tailBuffer) String() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	out := bytes.Buffer{}
+	for _, line := range t.lines {
+		out.WriteString(line + "\n")
+	}
+	out.Write(t.partial)
+
+	return string(out.Bytes())
+}
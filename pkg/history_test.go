@@ -0,0 +1,150 @@
+package pkg_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-ini/ini"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+func TestHistory(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg, err := ini.Load([]byte(`
+silent = true
+
+[build]
+command = seq 30 | sed 's/^/line /' && exit 2
+
+[test]
+command = echo ok
+`))
+	require.NoError(t, err)
+
+	watchers, err := pkg.WatchersFromConf(cfg, stderrLogger(t), pkg.ExecutorFromName)
+	require.NoError(t, err)
+
+	h, err := pkg.OpenHistory(dir)
+	require.NoError(t, err)
+	require.NoError(t, h.Watch(watchers))
+
+	status, err := pkg.ReadStatus(h.StatusPath)
+	require.NoError(t, err)
+	require.Equal(t, os.Getpid(), status.PID)
+	require.Len(t, status.Watchers, 2)
+	require.Equal(t, pkg.StateIdle, status.Watchers[0].State)
+	require.Nil(t, status.Watchers[0].LastRun)
+
+	require.Error(t, watchers[0].Trigger("main.go"))
+	require.NoError(t, watchers[1].Trigger("main_test.go"))
+
+	records, err := pkg.ReadHistory(h.Path, 0)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	build := records[0]
+	require.Equal(t, "build", build.Watcher)
+	require.Equal(t, pkg.CauseManual, build.Cause)
+	require.Equal(t, []pkg.RunEvent{{Path: "main.go", Op: "Write"}}, build.Events)
+	require.Equal(t, 2, build.ExitCode)
+	require.NotEmpty(t, build.Error)
+	require.False(t, build.Start.IsZero())
+
+	lines := strings.Split(strings.TrimSuffix(build.Output, "\n"), "\n")
+	require.Len(t, lines, pkg.HistoryOutputLines, "only the end of the output is kept")
+	require.Equal(t, "line 30", lines[len(lines)-1])
+
+	require.Greater(t, records[1].ID, build.ID)
+	require.Equal(t, "ok\n", records[1].Output)
+
+	last, err := pkg.ReadHistory(h.Path, 1)
+	require.NoError(t, err)
+	require.Equal(t, records[1:], last)
+
+	status, err = pkg.ReadStatus(h.StatusPath)
+	require.NoError(t, err)
+	require.Equal(t, pkg.StateFailed, status.Watchers[0].State)
+	require.Equal(t, build.ID, status.Watchers[0].LastRun.ID)
+	require.Equal(t, pkg.StateIdle, status.Watchers[1].State)
+
+	reopened, err := pkg.OpenHistory(dir)
+	require.NoError(t, err)
+	require.NoError(t, reopened.Watch(watchers[1:]))
+	require.NoError(t, watchers[1].Trigger(""))
+
+	records, err = pkg.ReadHistory(h.Path, 0)
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	require.Greater(t, records[2].ID, records[1].ID, "run ids continue after a restart")
+}
+
+func TestHistoryCompaction(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, pkg.HistoryFile)
+
+	// a partial line is left by an interrupted write.
+	lines := &strings.Builder{}
+	for i := 1; i < 2*pkg.HistoryMaxRuns; i++ {
+		fmt.Fprintf(lines, `{"id":%d,"watcher":"w"}`+"\n", i)
+	}
+	lines.WriteString(`{"id":`)
+	require.NoError(t, os.WriteFile(path, []byte(lines.String()), 0644))
+
+	h, err := pkg.OpenHistory(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, h.Append(pkg.RunRecord{ID: 2 * pkg.HistoryMaxRuns, Watcher: "w"}))
+
+	records, err := pkg.ReadHistory(path, 0)
+	require.NoError(t, err)
+	require.Len(t, records, pkg.HistoryMaxRuns)
+	require.Equal(t, int64(pkg.HistoryMaxRuns+1), records[0].ID)
+	require.Equal(t, int64(2*pkg.HistoryMaxRuns), records[len(records)-1].ID)
+}
+
+func TestHistoryConcurrentStatus(t *testing.T) {
+	conf := "silent = true\n"
+	for i := 0; i < 8; i++ {
+		conf += fmt.Sprintf("[w%d]\ncommand = true\n", i)
+	}
+
+	cfg, err := ini.Load([]byte(conf))
+	require.NoError(t, err)
+
+	watchers, err := pkg.WatchersFromConf(cfg, stderrLogger(t), pkg.ExecutorFromName)
+	require.NoError(t, err)
+	for _, w := range watchers {
+		defer w.Notifier.Close()
+	}
+
+	h, err := pkg.OpenHistory(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, h.Watch(watchers))
+
+	wg := sync.WaitGroup{}
+	for _, w := range watchers {
+		wg.Add(1)
+		go func(w *pkg.Watcher) {
+			defer wg.Done()
+			for i := 0; i < 5; i++ {
+				require.NoError(t, w.Trigger())
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// the last status written holds the last runs of every watcher.
+	status, err := pkg.ReadStatus(h.StatusPath)
+	require.NoError(t, err)
+	for i, w := range watchers {
+		require.Equal(t, pkg.StateIdle, status.Watchers[i].State, w.Name)
+		require.Equal(t, w.State().LastRun.ID, status.Watchers[i].LastRun.ID, w.Name)
+	}
+}
@@ -0,0 +1,102 @@
+package pkg
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RunResult describes a finished run of the command of a watcher, retries
+// included.
+type RunResult struct {
+	ExitCode int
+	Duration time.Duration
+	// OutputFile holds the output of the command, if it was captured.
+	OutputFile string
+	Err        error
+}
+
+// ExitCode returns the exit code of a command from the error returned by
+// its executor: 0 on success, 124 on timeout like timeout(1) does, and -1
+// if it is unknown, like when the command was killed by a signal.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	if errors.Is(err, ErrTimeout) {
+		return 124
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+
+	return -1
+}
+
+// MakeRunCommand replaces variables describing the result of a run, then
+// the ones supported by MakeCommand are left to the executor.
+// %run.exit_code is replaced with the exit code of the command.
+// %run.duration is replaced with the duration of the run, like 1.5s.
+// %run.output_file is replaced with the path of the file holding the output of the command.
+func MakeRunCommand(cmdTemplate string, result RunResult) string {
+	command := strings.Replace(cmdTemplate, "%run.exit_code", strconv.Itoa(result.ExitCode), -1)
+	command = strings.Replace(command, "%run.duration", result.Duration.Round(time.Millisecond).String(), -1)
+	command = strings.Replace(command, "%run.output_file", result.OutputFile, -1)
+	return command
+}
+
+// Hooks are command templates run around the command of a watcher, through
+// an executor built by Provider for each of them. WatcherFromConf runs them
+// through the shell, whatever the executor of the watcher is.
+type Hooks struct {
+	// OnStart is run before the command, without %run.* variables.
+	OnStart   string
+	OnSuccess string
+	OnFailure string
+
+	ExecutorName string
+	Options      ExecOptions
+	Provider     ExecutorProvider
+}
+
+// NeedsOutput returns true if a hook uses the output of the command.
+func (h Hooks) NeedsOutput() bool {
+	return strings.Contains(h.OnSuccess, "%run.output_file") || strings.Contains(h.OnFailure, "%run.output_file")
+}
+
+// Start runs the OnStart hook, if any.
+func (h Hooks) Start(event NotificationEvent, eventFile string) error {
+	return h.run(h.OnStart, event, eventFile)
+}
+
+// Finish runs the OnSuccess or OnFailure hook, depending on the result.
+func (h Hooks) Finish(event NotificationEvent, eventFile string, result RunResult) error {
+	template := h.OnSuccess
+	if result.Err != nil {
+		template = h.OnFailure
+	}
+
+	if template == "" {
+		return nil
+	}
+
+	return h.run(MakeRunCommand(template, result), event, eventFile)
+}
+
+func (h Hooks) run(commandTemplate string, event NotificationEvent, eventFile string) error {
+	if commandTemplate == "" {
+		return nil
+	}
+
+	executor, err := h.Provider(h.ExecutorName, commandTemplate, h.Options)
+	if err != nil {
+		return err
+	}
+
+	return executor.Exec(event, eventFile)
+}
@@ -0,0 +1,72 @@
+package pkg_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-ini/ini"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+func TestHooks(t *testing.T) {
+	workdir := t.TempDir()
+
+	cfg, err := ini.Load([]byte(`
+workdir = ` + workdir + `
+silent = true
+on_start = echo started %event.file > started
+on_failure = echo %run.exit_code $(cat %run.output_file) > failure
+
+[failing]
+command = echo output && sh -c "exit 3"
+
+[succeeding]
+command = true
+on_success = echo %event.op > success
+
+[printing]
+executor = stdout
+command = unused
+on_success = echo printed %event.file > printed
+
+[raw]
+executor = raw
+command = true
+on_success = echo raw %run.exit_code > raw
+`))
+	require.NoError(t, err)
+
+	watchers, err := pkg.WatchersFromConf(cfg, stderrLogger(t), pkg.ExecutorFromName)
+	require.NoError(t, err)
+	require.Len(t, watchers, 4)
+
+	read := func(name string) string {
+		b, err := os.ReadFile(filepath.Join(workdir, name))
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	require.Error(t, watchers[0].Trigger("file.go"))
+	require.Equal(t, "started file.go\n", read("started"))
+	require.Equal(t, "3 output\n", read("failure"))
+
+	require.NoError(t, watchers[1].Trigger("file.go"))
+	require.Equal(t, "Write\n", read("success"))
+
+	// hooks run through the shell whatever the executor of the watcher.
+	require.NoError(t, watchers[2].Trigger("file.go"))
+	require.Equal(t, "printed file.go\n", read("printed"))
+
+	require.NoError(t, watchers[3].Trigger("file.go"))
+	require.Equal(t, "raw 0\n", read("raw"))
+}
+
+func TestExitCode(t *testing.T) {
+	exec, err := pkg.NewExecutorShell(os.Stdout, "exit 2", pkg.ExecOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 2, pkg.ExitCode(exec.Exec(pkg.NotificationEvent{}, "")))
+	require.Equal(t, 0, pkg.ExitCode(nil))
+}
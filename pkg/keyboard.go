@@ -0,0 +1,227 @@
+package pkg
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Keys read by the keyboard.
+const (
+	keyEnter     = '\n'
+	keyReturn    = '\r'
+	keyEscape    = 0x1b
+	keyBackspace = 0x7f
+	keyCtrlH     = 0x08
+	keyCtrlD     = 0x04
+)
+
+const keyboardHelp = `keys:
+  Enter    re-run the watcher that ran last, or all of them
+  a        re-run all watchers
+  r <n>    re-run the watcher numbered n by l, or named n
+  p [<n>]  pause or resume a watcher, all of them without n
+  c        clear the screen
+  l        list watchers
+  q        quit
+`
+
+// Keyboard runs the watchers of Runner from keys typed in a terminal, read
+// one by one, see keyboardHelp. Messages are written to Output, which should
+// not be the output of the stdout executor, and Quit is called on q.
+type Keyboard struct {
+	Runner *Runner
+	Output io.Writer
+	Quit   func()
+
+	lock sync.Mutex
+}
+
+// Run reads keys until in is closed or q is typed.
+func (k *Keyboard) Run(in io.Reader) error {
+	keys := bufio.NewReader(in)
+
+	for {
+		key, err := keys.ReadByte()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("keyboard: %w", err)
+		}
+
+		switch key {
+		case keyEnter, keyReturn:
+			k.rerunLast()
+		case 'a':
+			k.rerun(k.Runner.Watchers())
+		case 'r':
+			if arg, ok, err := k.prompt(keys, "run: "); err != nil {
+				return err
+			} else if ok && arg != "" {
+				if w := k.find(arg); w != nil {
+					k.rerun([]*Watcher{w})
+				}
+			}
+		case 'p':
+			if arg, ok, err := k.prompt(keys, "pause/resume (all): "); err != nil {
+				return err
+			} else if ok {
+				k.togglePause(arg)
+			}
+		case 'c':
+			k.printf("%s", termClear)
+		case 'l':
+			k.list()
+		case 'h', '?':
+			k.printf("%s", keyboardHelp)
+		case 'q', keyCtrlD:
+			if k.Quit != nil {
+				k.Quit()
+			}
+			return nil
+		}
+	}
+}
+
+// prompt echoes the keys typed until Enter, and returns the line. ok is
+// false when Escape cancelled it.
+func (k *Keyboard) prompt(keys *bufio.Reader, prompt string) (line string, ok bool, err error) {
+	k.printf("%s", prompt)
+
+	var typed []byte
+	for {
+		key, err := keys.ReadByte()
+		if err != nil {
+			k.printf("\n")
+			if errors.Is(err, io.EOF) {
+				return "", false, nil
+			}
+			return "", false, fmt.Errorf("keyboard: %w", err)
+		}
+
+		switch {
+		case key == keyEnter || key == keyReturn:
+			k.printf("\n")
+			return strings.TrimSpace(string(typed)), true, nil
+		case key == keyEscape:
+			k.printf("\n")
+			return "", false, nil
+		case key == keyBackspace || key == keyCtrlH:
+			if len(typed) > 0 {
+				typed = typed[:len(typed)-1]
+				k.printf("\b \b")
+			}
+		case key >= ' ' && key < keyBackspace:
+			typed = append(typed, key)
+			k.printf("%c", key)
+		}
+	}
+}
+
+func (k *Keyboard) printf(format string, args ...interface{}) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	fmt.Fprintf(k.Output, format, args...)
+}
+
+// find returns the watcher numbered or named arg, or prints that there is
+// none.
+func (k *Keyboard) find(arg string) *Watcher {
+	watchers := k.Runner.Watchers()
+
+	if n, err := strconv.Atoi(arg); err == nil && n >= 1 && n <= len(watchers) {
+		return watchers[n-1]
+	}
+
+	for _, w := range watchers {
+		if w.Name == arg {
+			return w
+		}
+	}
+
+	k.printf("watchngo: unknown watcher %s\n", arg)
+	return nil
+}
+
+// rerunLast re-runs the watcher whose run started last, or all watchers if
+// none ran yet.
+func (k *Keyboard) rerunLast() {
+	var last *Watcher
+	var lastStart time.Time
+	for _, w := range k.Runner.Watchers() {
+		if run := w.State().LastRun; run != nil && run.Start.After(lastStart) {
+			last, lastStart = w, run.Start
+		}
+	}
+
+	if last == nil {
+		k.rerun(k.Runner.Watchers())
+		return
+	}
+	k.rerun([]*Watcher{last})
+}
+
+func (k *Keyboard) rerun(watchers []*Watcher) {
+	for _, w := range watchers {
+		if err := w.tryStart(); err != nil {
+			k.printf("watchngo: %s is running\n", w.Name)
+			continue
+		}
+
+		// failures are told by the output of the watcher.
+		go w.triggerStarted()
+	}
+}
+
+// togglePause pauses or resumes the watcher numbered or named arg. Without
+// arg, all watchers are paused, or resumed if they all are paused.
+func (k *Keyboard) togglePause(arg string) {
+	watchers := k.Runner.Watchers()
+	pause := false
+
+	if arg != "" {
+		w := k.find(arg)
+		if w == nil {
+			return
+		}
+		watchers = []*Watcher{w}
+	}
+
+	for _, w := range watchers {
+		if !w.Paused() {
+			pause = true
+		}
+	}
+
+	for _, w := range watchers {
+		if pause {
+			w.Pause()
+			k.printf("watchngo: %s paused\n", w.Name)
+		} else {
+			w.Resume()
+			k.printf("watchngo: %s resumed\n", w.Name)
+		}
+	}
+}
+
+func (k *Keyboard) list() {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	out := tabwriter.NewWriter(k.Output, 0, 4, 2, ' ', 0)
+	for i, w := range k.Runner.Watchers() {
+		state := w.State()
+		last := "-"
+		if run := state.LastRun; run != nil {
+			last = fmt.Sprintf("exit %d at %s in %s", run.ExitCode, run.Start.Format("15:04:05"), run.Duration.Round(time.Millisecond))
+		}
+		fmt.Fprintf(out, "%d\t%s\t%s\t%s\n", i+1, w.Name, state.State, last)
+	}
+	_ = out.Flush()
+}
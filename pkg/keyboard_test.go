@@ -0,0 +1,89 @@
+package pkg_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-ini/ini"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+func TestKeyboard(t *testing.T) {
+	cfg, err := ini.Load([]byte(`
+silent = true
+
+[build]
+command = true
+
+[test]
+command = true
+`))
+	require.NoError(t, err)
+
+	watchers, err := pkg.WatchersFromConf(cfg, stderrLogger(t), pkg.ExecutorFromName)
+	require.NoError(t, err)
+
+	runner, err := pkg.NewRunner(func() ([]*pkg.Watcher, error) { return watchers, nil })
+	require.NoError(t, err)
+
+	out := &syncBuffer{}
+	quit := make(chan struct{})
+	keyboard := &pkg.Keyboard{Runner: runner, Output: out, Quit: func() { close(quit) }}
+
+	in, keys := io.Pipe()
+	done := make(chan error)
+	go func() { done <- keyboard.Run(in) }()
+
+	lastRun := func(w *pkg.Watcher) int64 {
+		if run := w.State().LastRun; run != nil {
+			return run.ID
+		}
+		return 0
+	}
+	typeKeys := func(s string) {
+		_, err := keys.Write([]byte(s))
+		require.NoError(t, err)
+	}
+
+	// r with a number, then a name edited with backspace.
+	typeKeys("r2\n")
+	require.Eventually(t, func() bool { return lastRun(watchers[1]) != 0 }, time.Second*5, time.Millisecond*10)
+	require.Zero(t, lastRun(watchers[0]))
+
+	typeKeys("rbx\x7fuild\n")
+	require.Eventually(t, func() bool { return lastRun(watchers[0]) != 0 }, time.Second*5, time.Millisecond*10)
+
+	// Enter re-runs the watcher that ran last.
+	build, test := lastRun(watchers[0]), lastRun(watchers[1])
+	typeKeys("\n")
+	require.Eventually(t, func() bool { return lastRun(watchers[0]) != build }, time.Second*5, time.Millisecond*10)
+	require.Equal(t, test, lastRun(watchers[1]))
+
+	typeKeys("rnope\n")
+	typeKeys("r\x1b")
+	typeKeys("p\n")
+	require.Eventually(t, func() bool { return watchers[0].Paused() && watchers[1].Paused() }, time.Second, time.Millisecond*10)
+
+	typeKeys("p1\n")
+	require.Eventually(t, func() bool { return !watchers[0].Paused() }, time.Second, time.Millisecond*10)
+	require.True(t, watchers[1].Paused())
+
+	typeKeys("l")
+	require.Eventually(t, func() bool { return strings.Contains(out.String(), "2  test") }, time.Second, time.Millisecond*10)
+	require.Contains(t, out.String(), "unknown watcher nope")
+	require.Regexp(t, `1\s+build\s+idle\s+exit 0 at`, out.String())
+	require.Regexp(t, `2\s+test\s+paused`, out.String())
+
+	typeKeys("q")
+	require.NoError(t, <-done)
+
+	select {
+	case <-quit:
+	default:
+		t.Fatal("q did not quit")
+	}
+}
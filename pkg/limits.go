@@ -0,0 +1,84 @@
+package pkg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// I/O scheduling classes of IONice.
+const (
+	IOClassNone       = 0
+	IOClassRealtime   = 1
+	IOClassBestEffort = 2
+	IOClassIdle       = 3
+)
+
+// Limits restrict the resources of commands and of the processes they fork.
+// They are only applied on Linux, before commands are executed, zero values
+// are not applied.
+type Limits struct {
+	// Nice is the scheduling priority of the process group, from -20 to 19.
+	Nice int
+	// IOClass and IOLevel set the I/O scheduling priority of the process
+	// group, the level goes from 0 to 7 and is ignored by IOClassIdle.
+	IOClass int
+	IOLevel int
+	// CPU is the CPU time after which processes receive SIGXCPU, then
+	// SIGKILL one second later.
+	CPU time.Duration
+	// AS is the size of the address space in bytes, NoFile the number of
+	// open files.
+	AS     int64
+	NoFile uint64
+	// Memory caps the memory of each run, in bytes, in its own cgroup v2. It
+	// is ignored when watchngo cannot create cgroups.
+	Memory int64
+}
+
+// IsZero returns true when no limit is set.
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
+// ParseIONice reads an I/O scheduling priority as class[:level], where class
+// is idle, best-effort or realtime. The level defaults to 4.
+func ParseIONice(value string) (class int, level int, err error) {
+	parts := strings.SplitN(value, ":", 2)
+
+	switch parts[0] {
+	case "idle":
+		class = IOClassIdle
+	case "best-effort":
+		class = IOClassBestEffort
+	case "realtime":
+		class = IOClassRealtime
+	default:
+		return 0, 0, fmt.Errorf("ionice: unknown class %s", parts[0])
+	}
+
+	level = 4
+	if len(parts) == 2 {
+		if level, err = strconv.Atoi(parts[1]); err != nil || level < 0 || level > 7 {
+			return 0, 0, fmt.Errorf("ionice: level must be from 0 to 7: %s", parts[1])
+		}
+	}
+
+	return class, level, nil
+}
+
+// LimitError is returned when a command was killed because it reached one
+// of its Limits.
+type LimitError struct {
+	Limit string
+	Err   error
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("killed by %s limit: %v", e.Limit, e.Err)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,303 @@
+package pkg
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	ioprioClassShift = 13
+	ioprioWhoProcess = 1
+	rlimitNice       = 13
+	cgroupRoot       = "/sys/fs/cgroup"
+	// limitsHelper is the name watchngo runs itself with to apply limits
+	// before executing a command, so the processes it forks inherit them.
+	limitsHelper = "watchngo-limits"
+)
+
+// RunLimitsHelper applies the limits and executes the command when the
+// process was started by watchngo as its limitsHelper, it does not return
+// then. Programs running watchers with limits must call it first in main.
+func RunLimitsHelper() {
+	if len(os.Args) < 4 || os.Args[0] != limitsHelper {
+		return
+	}
+
+	// nice and ionice are set on the thread calling execve.
+	runtime.LockOSThread()
+
+	if err := execLimited(os.Args[1], os.Args[2], os.Args[3:]); err != nil {
+		fmt.Fprintf(os.Stderr, "watchngo: %v\n", err)
+		os.Exit(126)
+	}
+}
+
+// limitsRequest is given by watchngo to its limitsHelper.
+type limitsRequest struct {
+	Limits Limits
+	// Cgroup is the directory of the cgroup of the run, if any.
+	Cgroup string
+}
+
+// execLimited applies the limits of request to the current process and
+// replaces it with the command.
+func execLimited(request string, path string, argv []string) error {
+	var req limitsRequest
+	if err := json.Unmarshal([]byte(request), &req); err != nil {
+		return fmt.Errorf("limits: %w", err)
+	}
+	limits := req.Limits
+
+	if req.Cgroup != "" {
+		if err := (&cgroup{path: req.Cgroup}).add(os.Getpid()); err != nil {
+			return fmt.Errorf("limits: memory: %w", err)
+		}
+	}
+
+	if limits.Nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, limits.Nice); err != nil {
+			return fmt.Errorf("limits: nice: %w", err)
+		}
+	}
+
+	if limits.IOClass != IOClassNone {
+		prio := limits.IOClass<<ioprioClassShift | limits.IOLevel
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, 0, uintptr(prio)); errno != 0 {
+			return fmt.Errorf("limits: ionice: %w", errno)
+		}
+	}
+
+	if limits.CPU > 0 {
+		seconds := uint64((limits.CPU + time.Second - 1) / time.Second)
+		if err := syscall.Setrlimit(syscall.RLIMIT_CPU, &syscall.Rlimit{Cur: seconds, Max: seconds + 1}); err != nil {
+			return fmt.Errorf("limits: cpu: %w", err)
+		}
+	}
+
+	if limits.NoFile > 0 {
+		if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &syscall.Rlimit{Cur: limits.NoFile, Max: limits.NoFile}); err != nil {
+			return fmt.Errorf("limits: open files: %w", err)
+		}
+	}
+
+	// the address space is limited last, watchngo may already use more.
+	if limits.AS > 0 {
+		if err := syscall.Setrlimit(syscall.RLIMIT_AS, &syscall.Rlimit{Cur: uint64(limits.AS), Max: uint64(limits.AS)}); err != nil {
+			return fmt.Errorf("limits: address space: %w", err)
+		}
+	}
+
+	if err := syscall.Exec(path, argv, os.Environ()); err != nil {
+		return fmt.Errorf("exec %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// checkLimits returns an error if watchngo is not allowed to apply the
+// limits, as a lower nice or the realtime I/O class.
+func checkLimits(limits Limits) error {
+	if os.Geteuid() == 0 {
+		return nil
+	}
+
+	if limits.IOClass == IOClassRealtime {
+		return errors.New("ionice: the realtime class needs root")
+	}
+
+	if limits.Nice != 0 {
+		// the kernel returns 20 - nice.
+		current, err := syscall.Getpriority(syscall.PRIO_PROCESS, 0)
+		if err != nil {
+			return fmt.Errorf("nice: %w", err)
+		}
+		current = 20 - current
+
+		var max syscall.Rlimit
+		if err := syscall.Getrlimit(rlimitNice, &max); err != nil {
+			return fmt.Errorf("nice: %w", err)
+		}
+
+		if limits.Nice < current && uint64(20-limits.Nice) > max.Cur {
+			return fmt.Errorf("nice: %d is lower than the current %d, it needs root or a higher RLIMIT_NICE", limits.Nice, current)
+		}
+	}
+
+	return nil
+}
+
+// prepareLimits makes the command apply its limits before being executed,
+// through the limitsHelper. The returned function must be given the result
+// of the command, or the error of Start, it returns a LimitError if a limit
+// killed it.
+func prepareLimits(cmd *exec.Cmd, limits Limits, logger Logger) (func(error) error, error) {
+	noop := func(err error) error { return err }
+	if limits.IsZero() {
+		return noop, nil
+	}
+
+	var cg *cgroup
+	if limits.Memory > 0 {
+		var err error
+		if cg, err = newRunCgroup(limits.Memory); err != nil {
+			if logger != nil {
+				cgroupWarning.Do(func() { logger.Warn("memory limits disabled", F(FieldError, err)) })
+			}
+		}
+	}
+
+	req := limitsRequest{Limits: limits}
+	if cg != nil {
+		req.Cgroup = cg.path
+	}
+
+	request, err := json.Marshal(req)
+	if err != nil {
+		if cg != nil {
+			cg.remove()
+		}
+		return nil, fmt.Errorf("limits: %w", err)
+	}
+
+	// /proc/self/exe is still watchngo when its binary was replaced.
+	cmd.Args = append([]string{limitsHelper, string(request), cmd.Path}, cmd.Args...)
+	cmd.Path = "/proc/self/exe"
+
+	return func(err error) error {
+		if cg != nil {
+			defer cg.remove()
+		}
+
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return err
+		}
+
+		if cg != nil && cg.oomKilled() {
+			return &LimitError{Limit: "memory", Err: err}
+		}
+
+		status, ok := exitErr.Sys().(syscall.WaitStatus)
+		if !ok || limits.CPU <= 0 {
+			return err
+		}
+
+		used := exitErr.UserTime() + exitErr.SystemTime()
+		switch {
+		case status.Signaled() && status.Signal() == syscall.SIGXCPU,
+			status.Signaled() && status.Signal() == syscall.SIGKILL && used >= limits.CPU,
+			status.Exited() && status.ExitStatus() == 128+int(syscall.SIGXCPU):
+			return &LimitError{Limit: "cpu", Err: err}
+		}
+
+		return err
+	}, nil
+}
+
+// cgroupWarning logs once that cgroups cannot be used.
+var cgroupWarning sync.Once
+
+var cgroupRuns = struct {
+	sync.Mutex
+	count int
+}{}
+
+type cgroup struct {
+	path string
+}
+
+// newRunCgroup creates a cgroup v2 below the one of watchngo, with a
+// memory cap.
+func newRunCgroup(memory int64) (*cgroup, error) {
+	base, err := selfCgroup()
+	if err != nil {
+		return nil, err
+	}
+
+	controllers, err := ioutil.ReadFile(filepath.Join(base, "cgroup.subtree_control"))
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.Contains(" "+strings.TrimSpace(string(controllers))+" ", " memory ") {
+		if err := ioutil.WriteFile(filepath.Join(base, "cgroup.subtree_control"), []byte("+memory"), 0644); err != nil {
+			return nil, fmt.Errorf("cannot enable the memory controller: %w", err)
+		}
+	}
+
+	cgroupRuns.Lock()
+	cgroupRuns.count++
+	name := fmt.Sprintf("watchngo-%d-%d", os.Getpid(), cgroupRuns.count)
+	cgroupRuns.Unlock()
+
+	cg := &cgroup{path: filepath.Join(base, name)}
+	if err := os.Mkdir(cg.path, 0755); err != nil {
+		return nil, err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(cg.path, "memory.max"), []byte(strconv.FormatInt(memory, 10)), 0644); err != nil {
+		cg.remove()
+		return nil, err
+	}
+
+	return cg, nil
+}
+
+// selfCgroup returns the directory of the cgroup v2 of watchngo.
+func selfCgroup() (string, error) {
+	fh, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close()
+
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "0::") {
+			return filepath.Join(cgroupRoot, strings.TrimPrefix(line, "0::")), nil
+		}
+	}
+
+	return "", errors.New("no cgroup v2")
+}
+
+func (c *cgroup) add(pid int) error {
+	return ioutil.WriteFile(filepath.Join(c.path, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644)
+}
+
+func (c *cgroup) oomKilled() bool {
+	events, err := ioutil.ReadFile(filepath.Join(c.path, "memory.events"))
+	if err != nil {
+		return false
+	}
+
+	for _, line := range strings.Split(string(events), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "oom_kill" && fields[1] != "0" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// remove the cgroup, once the processes it held are gone.
+func (c *cgroup) remove() {
+	for i := 0; i < 50; i++ {
+		if err := os.Remove(c.path); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+}
@@ -0,0 +1,60 @@
+package pkg_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+func TestLimits(t *testing.T) {
+	out := bytes.Buffer{}
+
+	// limits are applied before the command is executed, its children
+	// inherit them.
+	exec, err := pkg.NewExecutorShell(&out, "nice; ulimit -n; ulimit -v; ionice; sh -c 'nice; ulimit -n' & wait", pkg.ExecOptions{
+		Limits: pkg.Limits{
+			Nice:    10,
+			IOClass: pkg.IOClassIdle,
+			AS:      1 << 30,
+			NoFile:  64,
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, exec.Exec(pkg.NotificationEvent{}, "none"))
+	require.Equal(t, "10\n64\n1048576\nidle\n10\n64\n", out.String())
+}
+
+func TestLimitCPU(t *testing.T) {
+	exec, err := pkg.NewExecutorShell(&bytes.Buffer{}, "while :; do :; done", pkg.ExecOptions{
+		Timeout: time.Second * 10,
+		Limits:  pkg.Limits{CPU: time.Second},
+	})
+	require.NoError(t, err)
+
+	err = exec.Exec(pkg.NotificationEvent{}, "none")
+	var limitErr *pkg.LimitError
+	require.True(t, errors.As(err, &limitErr), "limit error: %v", err)
+	require.Equal(t, "cpu", limitErr.Limit)
+}
+
+func TestLimitsConf(t *testing.T) {
+	for _, conf := range []string{
+		"nice = 20",
+		"ionice = slow",
+		"ionice = best-effort:8",
+		"limit_cpu = 10",
+		"limit_as = 2X",
+		"limit_nofile = -1",
+	} {
+		_, err := watchersFromString(t, "[test]\ncommand = true\n"+conf+"\n")
+		require.Error(t, err, conf)
+	}
+
+	_, err := watchersFromString(t, "nice = 10\nionice = idle\n[test]\ncommand = true\nlimit_cpu = 1m\nlimit_as = 2G\nlimit_nofile = 1024\nlimit_memory = 512M\n")
+	require.NoError(t, err)
+}
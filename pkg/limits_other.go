@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package pkg
+
+import (
+	"os/exec"
+)
+
+// RunLimitsHelper does nothing, limits are only supported on Linux.
+func RunLimitsHelper() {}
+
+// prepareLimits does nothing, limits are only supported on Linux.
+func prepareLimits(cmd *exec.Cmd, limits Limits, logger Logger) (func(error) error, error) {
+	return func(err error) error { return err }, nil
+}
+
+// checkLimits accepts any limits, they are ignored.
+func checkLimits(limits Limits) error {
+	return nil
+}
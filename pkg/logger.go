@@ -2,33 +2,228 @@
 
 package pkg
 
-import "log"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
 
+// Level of a log entry, from the most to the least important.
+type Level int
+
+const (
+	LevelError Level = iota
+	LevelWarn
+	LevelInfo
+	LevelDebug
+	LevelTrace
+)
+
+var levelNames = []string{"error", "warn", "info", "debug", "trace"}
+
+func (l Level) String() string {
+	if l < LevelError || l > LevelTrace {
+		return "level(" + strconv.Itoa(int(l)) + ")"
+	}
+	return levelNames[l]
+}
+
+// ParseLevel reads a level name: error, warn, info, debug or trace.
+func ParseLevel(name string) (Level, error) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %s", name)
+}
+
+// Field is a key and its value attached to a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F returns a field.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Keys of the fields used by watchngo.
+const (
+	FieldWatcher  = "watcher"
+	FieldPath     = "path"
+	FieldOp       = "op"
+	FieldRunID    = "run_id"
+	FieldDuration = "duration"
+	FieldExitCode = "exit_code"
+	FieldError    = "error"
+)
+
+// Logger writes leveled entries made of a message and fields.
 type Logger interface {
-	Debug(fmt string, args ...interface{})
-	Log(fmt string, args ...interface{})
+	Error(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Debug(msg string, fields ...Field)
+	Trace(msg string, fields ...Field)
 }
 
+// SilentLogger drops every entry.
 type SilentLogger struct{}
 
-func (s SilentLogger) Debug(fmt string, args ...interface{}) {}
+func (s SilentLogger) Error(msg string, fields ...Field) {}
+
+func (s SilentLogger) Warn(msg string, fields ...Field) {}
+
+func (s SilentLogger) Info(msg string, fields ...Field) {}
 
-func (s SilentLogger) Log(fmt string, args ...interface{}) {}
+func (s SilentLogger) Debug(msg string, fields ...Field) {}
 
-type DebugLogger struct{ Logger Logger }
+func (s SilentLogger) Trace(msg string, fields ...Field) {}
 
-func (d DebugLogger) Debug(fmt string, args ...interface{}) {
-	d.Log(fmt, args...)
+// Log formats.
+const (
+	LogFormatText   = "text"
+	LogFormatJSON   = "json"
+	LogFormatLogfmt = "logfmt"
+)
+
+// NewLogger returns a logger writing entries up to the max level to out,
+// one per line, in one of the LogFormat formats.
+func NewLogger(out io.Writer, format string, max Level) (Logger, error) {
+	switch format {
+	case LogFormatText, LogFormatJSON, LogFormatLogfmt:
+	default:
+		return nil, fmt.Errorf("unknown log format %s", format)
+	}
+
+	return &logger{out: out, format: format, max: max}, nil
 }
 
-func (d DebugLogger) Log(fmt string, args ...interface{}) {
-	d.Logger.Log(fmt, args...)
+type logger struct {
+	lock   sync.Mutex
+	out    io.Writer
+	format string
+	max    Level
 }
 
-type InfoLogger struct{ Logger *log.Logger }
+func (l *logger) Error(msg string, fields ...Field) { l.log(LevelError, msg, fields) }
+
+func (l *logger) Warn(msg string, fields ...Field) { l.log(LevelWarn, msg, fields) }
+
+func (l *logger) Info(msg string, fields ...Field) { l.log(LevelInfo, msg, fields) }
+
+func (l *logger) Debug(msg string, fields ...Field) { l.log(LevelDebug, msg, fields) }
+
+func (l *logger) Trace(msg string, fields ...Field) { l.log(LevelTrace, msg, fields) }
+
+func (l *logger) log(level Level, msg string, fields []Field) {
+	if level > l.max {
+		return
+	}
+
+	now := time.Now()
+	line := bytes.Buffer{}
 
-func (i InfoLogger) Debug(_ string, _ ...interface{}) {}
+	switch l.format {
+	case LogFormatJSON:
+		entry := map[string]interface{}{
+			"time":  now.Format(time.RFC3339Nano),
+			"level": level.String(),
+			"msg":   msg,
+		}
+		for _, f := range fields {
+			entry[f.Key] = fieldValue(f.Value)
+		}
+		// map keys are sorted by encoding/json.
+		b, err := json.Marshal(entry)
+		if err != nil {
+			b, _ = json.Marshal(map[string]string{"level": level.String(), "msg": msg, "error": err.Error()})
+		}
+		line.Write(b)
+	case LogFormatLogfmt:
+		line.WriteString("time=" + now.Format(time.RFC3339Nano) + " level=" + level.String() + " msg=" + logfmtValue(msg))
+		writeLogfmtFields(&line, fields)
+	default:
+		fmt.Fprintf(&line, "%s %-5s %s", now.Format("2006/01/02 15:04:05"), strings.ToUpper(level.String()), msg)
+		writeLogfmtFields(&line, fields)
+	}
+
+	line.WriteByte('\n')
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	_, _ = l.out.Write(line.Bytes())
+}
+
+// fieldValue makes values readable once encoded.
+func fieldValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+func writeLogfmtFields(line *bytes.Buffer, fields []Field) {
+	for _, f := range fields {
+		line.WriteString(" " + f.Key + "=" + logfmtValue(fmt.Sprint(fieldValue(f.Value))))
+	}
+}
+
+// logfmtValue quotes values holding spaces, quotes or equal signs.
+func logfmtValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\r\n\"=\\") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// WithLevel returns a logger dropping entries of logger above the max level.
+func WithLevel(logger Logger, max Level) Logger {
+	return levelLogger{logger: logger, max: max}
+}
+
+type levelLogger struct {
+	logger Logger
+	max    Level
+}
+
+func (l levelLogger) Error(msg string, fields ...Field) {
+	l.logger.Error(msg, fields...)
+}
+
+func (l levelLogger) Warn(msg string, fields ...Field) {
+	if l.max >= LevelWarn {
+		l.logger.Warn(msg, fields...)
+	}
+}
+
+func (l levelLogger) Info(msg string, fields ...Field) {
+	if l.max >= LevelInfo {
+		l.logger.Info(msg, fields...)
+	}
+}
+
+func (l levelLogger) Debug(msg string, fields ...Field) {
+	if l.max >= LevelDebug {
+		l.logger.Debug(msg, fields...)
+	}
+}
 
-func (i InfoLogger) Log(fmt string, args ...interface{}) {
-	i.Logger.Printf(fmt, args...)
+func (l levelLogger) Trace(msg string, fields ...Field) {
+	if l.max >= LevelTrace {
+		l.logger.Trace(msg, fields...)
+	}
 }
@@ -0,0 +1,80 @@
+package pkg_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+func stderrLogger(t *testing.T) pkg.Logger {
+	logger, err := pkg.NewLogger(os.Stderr, pkg.LogFormatText, pkg.LevelTrace)
+	require.NoError(t, err)
+	return logger
+}
+
+func TestLoggerFormats(t *testing.T) {
+	out := bytes.Buffer{}
+	fields := []pkg.Field{
+		pkg.F(pkg.FieldWatcher, "build"),
+		pkg.F(pkg.FieldRunID, 3),
+		pkg.F(pkg.FieldOp, pkg.NotificationWrite),
+		pkg.F(pkg.FieldDuration, time.Millisecond*1500),
+		pkg.F(pkg.FieldError, errors.New("exit status 1")),
+	}
+
+	logger, err := pkg.NewLogger(&out, pkg.LogFormatText, pkg.LevelInfo)
+	require.NoError(t, err)
+	logger.Warn("command failed", fields...)
+	logger.Debug("dropped")
+	require.Regexp(t, `^\d{4}/\d\d/\d\d \d\d:\d\d:\d\d WARN  command failed watcher=build run_id=3 op=Write duration=1.5s error="exit status 1"\n$`, out.String())
+
+	out.Reset()
+	logger, err = pkg.NewLogger(&out, pkg.LogFormatLogfmt, pkg.LevelTrace)
+	require.NoError(t, err)
+	logger.Trace("event", fields[:2]...)
+	require.Regexp(t, `^time=\S+ level=trace msg=event watcher=build run_id=3\n$`, out.String())
+
+	out.Reset()
+	logger, err = pkg.NewLogger(&out, pkg.LogFormatJSON, pkg.LevelInfo)
+	require.NoError(t, err)
+	logger.Error("command failed", fields...)
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	require.Equal(t, "error", entry["level"])
+	require.Equal(t, "command failed", entry["msg"])
+	require.Equal(t, "build", entry["watcher"])
+	require.Equal(t, float64(3), entry["run_id"])
+	require.Equal(t, "1.5s", entry["duration"])
+	require.Equal(t, "exit status 1", entry["error"])
+
+	_, err = pkg.NewLogger(&out, "xml", pkg.LevelInfo)
+	require.Error(t, err)
+}
+
+func TestWithLevel(t *testing.T) {
+	out := bytes.Buffer{}
+	logger, err := pkg.NewLogger(&out, pkg.LogFormatLogfmt, pkg.LevelTrace)
+	require.NoError(t, err)
+
+	logger = pkg.WithLevel(logger, pkg.LevelWarn)
+	logger.Info("dropped")
+	logger.Debug("dropped")
+	logger.Error("kept")
+	logger.Warn("kept")
+	require.Equal(t, 2, bytes.Count(out.Bytes(), []byte("msg=kept")))
+	require.NotContains(t, out.String(), "dropped")
+
+	level, err := pkg.ParseLevel("TRACE")
+	require.NoError(t, err)
+	require.Equal(t, pkg.LevelTrace, level)
+	_, err = pkg.ParseLevel("verbose")
+	require.Error(t, err)
+}
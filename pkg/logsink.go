@@ -0,0 +1,290 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default sockets of the log sinks.
+const (
+	DefaultJournaldSocket = "/run/systemd/journal/socket"
+	DefaultSyslogSocket   = "/dev/log"
+)
+
+// syslogFacility is the user-level facility.
+const syslogFacility = 1
+
+// syslogSDID identifies the structured data of syslog messages, 32473 is the
+// enterprise number reserved for documentation.
+const syslogSDID = "watchngo@32473"
+
+// OpenLogSink returns the logger of a sink:
+//
+//	stderr, the default, writes in the given format
+//	journald[:<socket>] uses the native journald protocol
+//	syslog[:unix://<socket>|udp://<host:port>] sends RFC 5424 messages
+func OpenLogSink(sink, format string, max Level) (Logger, error) {
+	name, addr := sink, ""
+	if parts := strings.SplitN(sink, ":", 2); len(parts) == 2 {
+		name, addr = parts[0], parts[1]
+	}
+
+	switch name {
+	case "", "stderr":
+		return NewLogger(os.Stderr, format, max)
+	case "journald":
+		if addr == "" {
+			addr = DefaultJournaldSocket
+		}
+		return NewJournaldLogger(addr, "watchngo", max)
+	case "syslog":
+		network := "unix"
+		if addr == "" {
+			addr = DefaultSyslogSocket
+		} else {
+			u, err := url.Parse(addr)
+			if err != nil {
+				return nil, fmt.Errorf("log sink: %w", err)
+			}
+			network, addr = u.Scheme, u.Host+u.Path
+		}
+		return NewSyslogLogger(network, addr, "watchngo", max)
+	default:
+		return nil, fmt.Errorf("log sink: unknown sink %s", name)
+	}
+}
+
+// NewJournaldLogger sends entries to journald through its native protocol,
+// fields become journal fields named in upper case: watcher is WATCHER.
+func NewJournaldLogger(socket, identifier string, max Level) (Logger, error) {
+	l := &socketLogger{
+		network: "unixgram",
+		addr:    socket,
+		max:     max,
+		encode: func(level Level, msg string, fields []Field) []byte {
+			entry := bytes.Buffer{}
+			writeJournalField(&entry, "MESSAGE", msg)
+			writeJournalField(&entry, "PRIORITY", strconv.Itoa(syslogSeverity(level)))
+			writeJournalField(&entry, "SYSLOG_IDENTIFIER", identifier)
+			for _, f := range fields {
+				writeJournalField(&entry, journalKey(f.Key), fmt.Sprint(fieldValue(f.Value)))
+			}
+			return entry.Bytes()
+		},
+	}
+
+	return l, l.dial()
+}
+
+// NewSyslogLogger sends RFC 5424 messages over a unix datagram or UDP socket,
+// fields are kept as structured data. network is unix or udp.
+func NewSyslogLogger(network, addr, tag string, max Level) (Logger, error) {
+	switch network {
+	case "unix":
+		network = "unixgram"
+	case "udp":
+	default:
+		return nil, fmt.Errorf("log sink: syslog: unsupported network %s", network)
+	}
+
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	pid := os.Getpid()
+
+	l := &socketLogger{
+		network: network,
+		addr:    addr,
+		max:     max,
+		encode: func(level Level, msg string, fields []Field) []byte {
+			entry := bytes.Buffer{}
+			fmt.Fprintf(&entry, "<%d>1 %s %s %s %d - ", syslogFacility*8+syslogSeverity(level), time.Now().Format(time.RFC3339Nano), hostname, tag, pid)
+
+			if len(fields) == 0 {
+				entry.WriteString("-")
+			} else {
+				entry.WriteString("[" + syslogSDID)
+				for _, f := range fields {
+					entry.WriteString(" " + syslogParamName(f.Key) + "=\"" + syslogParamValue(fmt.Sprint(fieldValue(f.Value))) + "\"")
+				}
+				entry.WriteString("]")
+			}
+
+			entry.WriteString(" " + msg)
+			return entry.Bytes()
+		},
+	}
+
+	return l, l.dial()
+}
+
+// socketLogger sends encoded entries as datagrams. Entries are dropped when
+// the socket is not available.
+type socketLogger struct {
+	lock    sync.Mutex
+	network string
+	addr    string
+	conn    net.Conn
+	max     Level
+	encode  func(level Level, msg string, fields []Field) []byte
+}
+
+func (l *socketLogger) dial() error {
+	conn, err := net.Dial(l.network, l.addr)
+	if err != nil {
+		return fmt.Errorf("log sink: %w", err)
+	}
+	l.conn = conn
+	return nil
+}
+
+func (l *socketLogger) Error(msg string, fields ...Field) { l.log(LevelError, msg, fields) }
+
+func (l *socketLogger) Warn(msg string, fields ...Field) { l.log(LevelWarn, msg, fields) }
+
+func (l *socketLogger) Info(msg string, fields ...Field) { l.log(LevelInfo, msg, fields) }
+
+func (l *socketLogger) Debug(msg string, fields ...Field) { l.log(LevelDebug, msg, fields) }
+
+func (l *socketLogger) Trace(msg string, fields ...Field) { l.log(LevelTrace, msg, fields) }
+
+func (l *socketLogger) log(level Level, msg string, fields []Field) {
+	if level > l.max {
+		return
+	}
+
+	entry := l.encode(level, msg, fields)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	// reconnect once, the daemon may have been restarted.
+	for i := 0; i < 2; i++ {
+		if l.conn == nil && l.dial() != nil {
+			return
+		}
+
+		if _, err := l.conn.Write(entry); err == nil {
+			return
+		}
+
+		l.conn.Close()
+		l.conn = nil
+	}
+}
+
+func syslogSeverity(level Level) int {
+	switch level {
+	case LevelError:
+		return 3
+	case LevelWarn:
+		return 4
+	case LevelInfo:
+		return 6
+	default:
+		return 7
+	}
+}
+
+// writeJournalField uses the binary form for values holding new lines.
+func writeJournalField(entry *bytes.Buffer, key, value string) {
+	if !strings.Contains(value, "\n") {
+		entry.WriteString(key + "=" + value + "\n")
+		return
+	}
+
+	entry.WriteString(key + "\n")
+	_ = binary.Write(entry, binary.LittleEndian, uint64(len(value)))
+	entry.WriteString(value + "\n")
+}
+
+// journalKey returns a valid journal field name: upper case letters, digits
+// and underscores, not starting with an underscore or a digit.
+func journalKey(key string) string {
+	name := []byte(strings.ToUpper(key))
+	for i, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			name[i] = '_'
+		}
+	}
+
+	key = strings.TrimLeft(string(name), "_")
+	if key == "" || key[0] >= '0' && key[0] <= '9' {
+		key = "F_" + key
+	}
+
+	return key
+}
+
+// syslogParamName keeps printable characters allowed in parameter names.
+func syslogParamName(key string) string {
+	name := []byte(key)
+	for i, c := range name {
+		if c <= ' ' || c > '~' || c == '=' || c == ']' || c == '"' {
+			name[i] = '_'
+		}
+	}
+
+	if len(name) > 32 {
+		name = name[:32]
+	}
+
+	return string(name)
+}
+
+func syslogParamValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
+
+// NewLogWriter returns a writer logging each line written to it, used to
+// send the output of commands to a log sink.
+func NewLogWriter(logger Logger, fields ...Field) *LogWriter {
+	return &LogWriter{logger: logger, fields: fields}
+}
+
+// LogWriter logs lines at the info level, the logger must not filter them
+// out.
+type LogWriter struct {
+	lock    sync.Mutex
+	logger  Logger
+	fields  []Field
+	partial []byte
+}
+
+func (w *LogWriter) Write(b []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	data := append(w.partial, b...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		w.logger.Info(string(bytes.TrimRight(data[:i], "\r")), w.fields...)
+		data = data[i+1:]
+	}
+	w.partial = append([]byte(nil), data...)
+
+	return len(b), nil
+}
+
+// Flush logs the last line when it does not end with a new line.
+func (w *LogWriter) Flush() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if len(w.partial) > 0 {
+		w.logger.Info(string(bytes.TrimRight(w.partial, "\r")), w.fields...)
+		w.partial = nil
+	}
+}
@@ -0,0 +1,114 @@
+package pkg_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-ini/ini"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+func readDatagram(t *testing.T, conn net.PacketConn) string {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	b := make([]byte, 65536)
+	n, _, err := conn.ReadFrom(b)
+	require.NoError(t, err)
+	return string(b[:n])
+}
+
+func TestJournaldLogger(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "journal.sock")
+	journal, err := net.ListenPacket("unixgram", socket)
+	require.NoError(t, err)
+	defer journal.Close()
+
+	logger, err := pkg.OpenLogSink("journald:"+socket, pkg.LogFormatText, pkg.LevelInfo)
+	require.NoError(t, err)
+
+	logger.Debug("dropped")
+	logger.Warn("command failed", pkg.F(pkg.FieldWatcher, "build"), pkg.F(pkg.FieldRunID, 2), pkg.F("step.name", "vet"))
+	require.Equal(t, "MESSAGE=command failed\nPRIORITY=4\nSYSLOG_IDENTIFIER=watchngo\nWATCHER=build\nRUN_ID=2\nSTEP_NAME=vet\n", readDatagram(t, journal))
+
+	logger.Info("two\nlines")
+	size := make([]byte, 8)
+	binary.LittleEndian.PutUint64(size, 9)
+	require.Equal(t, "MESSAGE\n"+string(size)+"two\nlines\nPRIORITY=6\nSYSLOG_IDENTIFIER=watchngo\n", readDatagram(t, journal))
+}
+
+func TestSyslogLogger(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer server.Close()
+
+	logger, err := pkg.OpenLogSink("syslog:udp://"+server.LocalAddr().String(), pkg.LogFormatText, pkg.LevelTrace)
+	require.NoError(t, err)
+
+	logger.Error("watcher stopped", pkg.F(pkg.FieldWatcher, "build"), pkg.F(pkg.FieldError, `bad "quote" ]`))
+	require.Regexp(t, `^<11>1 \S+ \S+ watchngo \d+ - \[watchngo@32473 watcher="build" error="bad \\"quote\\" \\]"\] watcher stopped$`, readDatagram(t, server))
+
+	logger.Trace("event")
+	require.Regexp(t, `^<15>1 \S+ \S+ watchngo \d+ - - event$`, readDatagram(t, server))
+
+	socket := filepath.Join(t.TempDir(), "log.sock")
+	devLog, err := net.ListenPacket("unixgram", socket)
+	require.NoError(t, err)
+	defer devLog.Close()
+
+	logger, err = pkg.OpenLogSink("syslog:unix://"+socket, pkg.LogFormatText, pkg.LevelInfo)
+	require.NoError(t, err)
+	logger.Info("running watcher")
+	require.Contains(t, readDatagram(t, devLog), "running watcher")
+
+	_, err = pkg.OpenLogSink("syslog:tcp://127.0.0.1:514", pkg.LogFormatText, pkg.LevelInfo)
+	require.Error(t, err)
+	_, err = pkg.OpenLogSink("kafka", pkg.LogFormatText, pkg.LevelInfo)
+	require.Error(t, err)
+}
+
+func TestLogWriter(t *testing.T) {
+	out := bytes.Buffer{}
+	logger, err := pkg.NewLogger(&out, pkg.LogFormatLogfmt, pkg.LevelInfo)
+	require.NoError(t, err)
+
+	w := pkg.NewLogWriter(logger, pkg.F(pkg.FieldWatcher, "build"))
+	_, _ = w.Write([]byte("ok\npar"))
+	_, _ = w.Write([]byte("tial\n"))
+	require.Regexp(t, `^time=\S+ level=info msg=ok watcher=build\ntime=\S+ level=info msg=partial watcher=build\n$`, out.String())
+
+	out.Reset()
+	_, _ = w.Write([]byte("no new line"))
+	require.Empty(t, out.String())
+	w.Flush()
+	require.Regexp(t, `^time=\S+ level=info msg="no new line" watcher=build\n$`, out.String())
+}
+
+func TestLogOutputConf(t *testing.T) {
+	out := &syncBuffer{}
+	logger, err := pkg.NewLogger(out, pkg.LogFormatLogfmt, pkg.LevelTrace)
+	require.NoError(t, err)
+
+	cfg, err := ini.Load([]byte(`
+log_output = true
+log_level = warn
+
+[build]
+command = printf 'built\nno new line'
+`))
+	require.NoError(t, err)
+
+	watchers, err := pkg.WatchersFromConf(cfg, logger, pkg.ExecutorFromName)
+	require.NoError(t, err)
+
+	// the output is logged whatever the log level, the last line once the
+	// run finished.
+	require.NoError(t, watchers[0].Trigger())
+	require.Contains(t, out.String(), "level=info msg=built watcher=build\n")
+	require.Contains(t, out.String(), `level=info msg="no new line" watcher=build`)
+	require.NotContains(t, out.String(), "running command")
+}
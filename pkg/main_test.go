@@ -0,0 +1,14 @@
+package pkg_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+// TestMain lets the test binary act as the limits helper of the watchers.
+func TestMain(m *testing.M) {
+	pkg.RunLimitsHelper()
+	os.Exit(m.Run())
+}
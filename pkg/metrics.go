@@ -0,0 +1,268 @@
+package pkg
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcomes of runs in metrics.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	// OutcomeKilled is a command stopped by its timeout or a limit.
+	OutcomeKilled = "killed"
+)
+
+// Buckets of the metrics histograms.
+var (
+	RunDurationBuckets  = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+	LatencyBuckets      = []float64{0.25, 0.3, 0.5, 0.75, 1, 2.5, 5, 10, 30}
+	BatchSizeBuckets    = []float64{1, 2, 5, 10, 25, 50, 100, 250, 1000}
+	metricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// Metrics counts what happens to watchers, and serves them in the Prometheus
+// text format.
+type Metrics struct {
+	lock     sync.Mutex
+	watchers []*Watcher
+
+	eventsReceived *metricVec
+	eventsFiltered *metricVec
+	eventsDropped  *metricVec
+	notifierErrors *metricVec
+	runs           *metricVec
+	batchSize      *metricVec
+	runDuration    *metricVec
+	latency        *metricVec
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		eventsReceived: newCounterVec("watchngo_events_received_total", "File changes received by a watcher.", "watcher", "op"),
+		eventsFiltered: newCounterVec("watchngo_events_filtered_total", "File changes not matching the filter of a watcher.", "watcher", "op"),
+		eventsDropped:  newCounterVec("watchngo_events_dropped_total", "File changes matching the filter but not running the command, by reason: paused, running, error or op.", "watcher", "op", "reason"),
+		notifierErrors: newCounterVec("watchngo_notifier_errors_total", "Errors of the file notifier.", "watcher"),
+		runs:           newCounterVec("watchngo_runs_total", "Finished runs by outcome: success, failure or killed.", "watcher", "outcome"),
+		batchSize:      newHistogramVec("watchngo_debounce_batch_size", "File changes handled at once after the debounce delay.", BatchSizeBuckets, "watcher"),
+		runDuration:    newHistogramVec("watchngo_run_duration_seconds", "Duration of runs, retries included.", RunDurationBuckets, "watcher"),
+		latency:        newHistogramVec("watchngo_event_to_exec_latency_seconds", "Delay between the first file change of a run and its start.", LatencyBuckets, "watcher"),
+	}
+}
+
+// Watch makes the watchers count their events and runs, replacing the
+// watchers reported by gauges.
+func (m *Metrics) Watch(watchers []*Watcher) {
+	m.lock.Lock()
+	m.watchers = watchers
+	m.lock.Unlock()
+
+	for _, w := range watchers {
+		w.Metrics = m
+	}
+}
+
+func (m *Metrics) eventReceived(watcher string, op Notification) {
+	m.eventsReceived.add(1, watcher, opLabel(op))
+}
+
+// eventRejected counts an event rejected for one of the Reject reasons.
+func (m *Metrics) eventRejected(watcher string, op Notification, reason string) {
+	if reason == RejectFilter {
+		m.eventsFiltered.add(1, watcher, opLabel(op))
+	} else {
+		m.eventsDropped.add(1, watcher, opLabel(op), reason)
+	}
+}
+
+func (m *Metrics) notifierError(watcher string) {
+	m.notifierErrors.add(1, watcher)
+}
+
+func (m *Metrics) batch(watcher string, size int) {
+	m.batchSize.observe(float64(size), watcher)
+}
+
+func (m *Metrics) runFinished(watcher, outcome string, duration time.Duration) {
+	m.runs.add(1, watcher, outcome)
+	m.runDuration.observe(duration.Seconds(), watcher)
+}
+
+func (m *Metrics) eventToExec(watcher string, latency time.Duration) {
+	m.latency.observe(latency.Seconds(), watcher)
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	out := bufio.NewWriter(rw)
+	defer out.Flush()
+
+	m.lock.Lock()
+	watchers := m.watchers
+	m.lock.Unlock()
+
+	watches := newGaugeVec("watchngo_watches", "Files and directories watched, inotify watches on Linux.", "watcher")
+	states := newGaugeVec("watchngo_watcher_state", "State of watchers, 1 for the current one.", "watcher", "state")
+	for _, w := range watchers {
+		state := w.State()
+		count := state.Locations
+		if notifier, ok := w.Notifier.(interface{ Watches() int }); ok {
+			count = notifier.Watches()
+		}
+		watches.set(float64(count), w.Name)
+
+		for _, name := range []string{StateIdle, StateDebouncing, StateRunning, StateFailed, StatePaused} {
+			value := 0.0
+			if name == state.State {
+				value = 1
+			}
+			states.set(value, w.Name, name)
+		}
+	}
+
+	for _, vec := range []*metricVec{m.eventsReceived, m.eventsFiltered, m.eventsDropped, m.notifierErrors, m.batchSize, m.runs, m.runDuration, m.latency, watches, states} {
+		vec.write(out)
+	}
+}
+
+// opLabel names the operations of a notification, like Create|Chmod.
+func opLabel(op Notification) string {
+	names := make([]string, 0, 1)
+	for bit := NotificationRemove; bit <= NotificationError; bit <<= 1 {
+		if op&bit != 0 {
+			names = append(names, bit.String())
+		}
+	}
+
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// metricVec is a counter, gauge or histogram with labels.
+type metricVec struct {
+	lock    sync.Mutex
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	samples map[string]*sample
+}
+
+type sample struct {
+	labels []string
+	value  float64
+	// counts are the cumulative bucket counts of histograms, value is their
+	// sum.
+	counts []uint64
+	count  uint64
+}
+
+func newCounterVec(name, help string, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, kind: "counter", labels: labels, samples: map[string]*sample{}}
+}
+
+func newGaugeVec(name, help string, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, kind: "gauge", labels: labels, samples: map[string]*sample{}}
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, kind: "histogram", labels: labels, buckets: buckets, samples: map[string]*sample{}}
+}
+
+// get must be called with the lock held.
+func (v *metricVec) get(values []string) *sample {
+	key := strings.Join(values, "\xff")
+	s, ok := v.samples[key]
+	if !ok {
+		s = &sample{labels: values, counts: make([]uint64, len(v.buckets))}
+		v.samples[key] = s
+	}
+	return s
+}
+
+func (v *metricVec) add(delta float64, values ...string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.get(values).value += delta
+}
+
+func (v *metricVec) set(value float64, values ...string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.get(values).value = value
+}
+
+func (v *metricVec) observe(value float64, values ...string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	s := v.get(values)
+	for i, bound := range v.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.value += value
+	s.count++
+}
+
+func (v *metricVec) write(out *bufio.Writer) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.kind)
+
+	keys := make([]string, 0, len(v.samples))
+	for key := range v.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := v.samples[key]
+		labels := v.formatLabels(s.labels)
+
+		if v.kind != "histogram" {
+			fmt.Fprintf(out, "%s%s %s\n", v.name, wrapLabels(labels), formatMetric(s.value))
+			continue
+		}
+
+		for i, bound := range v.buckets {
+			fmt.Fprintf(out, "%s_bucket%s %d\n", v.name, wrapLabels(labels, `le="`+formatMetric(bound)+`"`), s.counts[i])
+		}
+		fmt.Fprintf(out, "%s_bucket%s %d\n", v.name, wrapLabels(labels, `le="+Inf"`), s.count)
+		fmt.Fprintf(out, "%s_sum%s %s\n", v.name, wrapLabels(labels), formatMetric(s.value))
+		fmt.Fprintf(out, "%s_count%s %d\n", v.name, wrapLabels(labels), s.count)
+	}
+}
+
+func (v *metricVec) formatLabels(values []string) []string {
+	labels := make([]string, len(values))
+	for i, value := range values {
+		labels[i] = v.labels[i] + `="` + metricsLabelEscaper.Replace(value) + `"`
+	}
+	return labels
+}
+
+func wrapLabels(labels []string, extra ...string) string {
+	labels = append(labels[:len(labels):len(labels)], extra...)
+	if len(labels) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+func formatMetric(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,83 @@
+package pkg_test
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-ini/ini"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+func TestMetrics(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg, err := ini.Load([]byte(`
+silent = true
+
+[txt]
+match = ` + dir + `
+filter = \.txt$
+command = true
+
+[slow]
+match = ` + dir + `
+filter = ^$
+command = sleep 5
+timeout = 100ms
+kill_grace = 100ms
+`))
+	require.NoError(t, err)
+
+	watchers, err := pkg.WatchersFromConf(cfg, stderrLogger(t), pkg.ExecutorFromName)
+	require.NoError(t, err)
+
+	metrics := pkg.NewMetrics()
+	metrics.Watch(watchers)
+
+	scrape := func() string {
+		rec := httptest.NewRecorder()
+		metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		require.Contains(t, rec.Header().Get("Content-Type"), "version=0.0.4")
+		return rec.Body.String()
+	}
+
+	go func() { _ = watchers[0].Work() }()
+	defer watchers[0].Stop()
+
+	// the notifier watches the directory once Work started.
+	require.Eventually(t, func() bool {
+		return strings.Contains(scrape(), `watchngo_watches{watcher="txt"} 1`)
+	}, time.Second*5, time.Millisecond*20)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.go"), []byte("b"), 0644))
+
+	require.Eventually(t, func() bool {
+		return strings.Contains(scrape(), `watchngo_runs_total{watcher="txt",outcome="success"} 1`)
+	}, time.Second*5, time.Millisecond*20)
+
+	require.Error(t, watchers[1].Trigger())
+
+	out := scrape()
+	for _, line := range []string{
+		`watchngo_events_received_total{watcher="txt",op="Create"} 2`,
+		`watchngo_events_filtered_total{watcher="txt",op="Create"} 1`,
+		`watchngo_debounce_batch_size_count{watcher="txt"} 1`,
+		`watchngo_event_to_exec_latency_seconds_count{watcher="txt"} 1`,
+		`watchngo_event_to_exec_latency_seconds_bucket{watcher="txt",le="0.25"} 0`,
+		`watchngo_run_duration_seconds_count{watcher="txt"} 1`,
+		`watchngo_runs_total{watcher="slow",outcome="killed"} 1`,
+		`watchngo_run_duration_seconds_bucket{watcher="slow",le="0.1"} 0`,
+		`watchngo_run_duration_seconds_bucket{watcher="slow",le="+Inf"} 1`,
+		`watchngo_watcher_state{watcher="slow",state="failed"} 1`,
+		"# TYPE watchngo_run_duration_seconds histogram",
+	} {
+		require.Contains(t, out, line+"\n")
+	}
+}
@@ -7,6 +7,7 @@ package pkg_test
 import (
 	reflect "reflect"
 
+	pkg "github.com/Leryan/watchngo/pkg"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -34,35 +35,86 @@ func (m *MockLogger) EXPECT() *MockLoggerMockRecorder {
 }
 
 // Debug mocks base method.
-func (m *MockLogger) Debug(fmt string, args ...interface{}) {
+func (m *MockLogger) Debug(msg string, fields ...pkg.Field) {
 	m.ctrl.T.Helper()
-	varargs := []interface{}{fmt}
-	for _, a := range args {
+	varargs := []interface{}{msg}
+	for _, a := range fields {
 		varargs = append(varargs, a)
 	}
 	m.ctrl.Call(m, "Debug", varargs...)
 }
 
 // Debug indicates an expected call of Debug.
-func (mr *MockLoggerMockRecorder) Debug(fmt interface{}, args ...interface{}) *gomock.Call {
+func (mr *MockLoggerMockRecorder) Debug(msg interface{}, fields ...interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	varargs := append([]interface{}{fmt}, args...)
+	varargs := append([]interface{}{msg}, fields...)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Debug", reflect.TypeOf((*MockLogger)(nil).Debug), varargs...)
 }
 
-// Log mocks base method.
-func (m *MockLogger) Log(fmt string, args ...interface{}) {
+// Error mocks base method.
+func (m *MockLogger) Error(msg string, fields ...pkg.Field) {
 	m.ctrl.T.Helper()
-	varargs := []interface{}{fmt}
-	for _, a := range args {
+	varargs := []interface{}{msg}
+	for _, a := range fields {
 		varargs = append(varargs, a)
 	}
-	m.ctrl.Call(m, "Log", varargs...)
+	m.ctrl.Call(m, "Error", varargs...)
 }
 
-// Log indicates an expected call of Log.
-func (mr *MockLoggerMockRecorder) Log(fmt interface{}, args ...interface{}) *gomock.Call {
+// Error indicates an expected call of Error.
+func (mr *MockLoggerMockRecorder) Error(msg interface{}, fields ...interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	varargs := append([]interface{}{fmt}, args...)
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Log", reflect.TypeOf((*MockLogger)(nil).Log), varargs...)
+	varargs := append([]interface{}{msg}, fields...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Error", reflect.TypeOf((*MockLogger)(nil).Error), varargs...)
+}
+
+// Info mocks base method.
+func (m *MockLogger) Info(msg string, fields ...pkg.Field) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{msg}
+	for _, a := range fields {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "Info", varargs...)
+}
+
+// Info indicates an expected call of Info.
+func (mr *MockLoggerMockRecorder) Info(msg interface{}, fields ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{msg}, fields...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Info", reflect.TypeOf((*MockLogger)(nil).Info), varargs...)
+}
+
+// Trace mocks base method.
+func (m *MockLogger) Trace(msg string, fields ...pkg.Field) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{msg}
+	for _, a := range fields {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "Trace", varargs...)
+}
+
+// Trace indicates an expected call of Trace.
+func (mr *MockLoggerMockRecorder) Trace(msg interface{}, fields ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{msg}, fields...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Trace", reflect.TypeOf((*MockLogger)(nil).Trace), varargs...)
+}
+
+// Warn mocks base method.
+func (m *MockLogger) Warn(msg string, fields ...pkg.Field) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{msg}
+	for _, a := range fields {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "Warn", varargs...)
+}
+
+// Warn indicates an expected call of Warn.
+func (mr *MockLoggerMockRecorder) Warn(msg interface{}, fields ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{msg}, fields...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Warn", reflect.TypeOf((*MockLogger)(nil).Warn), varargs...)
 }
@@ -6,6 +6,7 @@ package pkg
 import (
 	"os"
 	"path"
+	"sync"
 
 	"github.com/fsnotify/fsnotify"
 )
@@ -45,6 +46,32 @@ type Notifier interface {
 
 type fsnotifyNotifier struct {
 	FSWatcher *fsnotify.Watcher
+	// watches holds the locations added and not removed.
+	watches *watchSet
+}
+
+// watchSet holds distinct watched paths.
+type watchSet struct {
+	lock  sync.Mutex
+	paths map[string]struct{}
+}
+
+func (s *watchSet) add(location string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.paths[path.Clean(location)] = struct{}{}
+}
+
+func (s *watchSet) remove(location string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.paths, path.Clean(location))
+}
+
+func (s *watchSet) len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.paths)
 }
 
 func (f fsnotifyNotifier) handleEvent(event fsnotify.Event) NotificationEvent {
@@ -78,6 +105,11 @@ func (f fsnotifyNotifier) handleEvent(event fsnotify.Event) NotificationEvent {
 		err = nil
 	}
 
+	// the watch of a removed or renamed location is gone.
+	if n&(NotificationRename|NotificationRemove) > 0 && ft != FileTypeDir {
+		f.watches.remove(fpath)
+	}
+
 	if err != nil {
 		n |= NotificationError
 	}
@@ -98,9 +130,15 @@ func (f fsnotifyNotifier) Events() <-chan NotificationEvent {
 
 		for {
 			select {
-			case event := <-f.FSWatcher.Events:
+			case event, ok := <-f.FSWatcher.Events:
+				if !ok {
+					return
+				}
 				out <- f.handleEvent(event)
-			case err := <-f.FSWatcher.Errors:
+			case err, ok := <-f.FSWatcher.Errors:
+				if !ok {
+					return
+				}
 				out <- NotificationEvent{
 					Notification: NotificationError,
 					Error:        err,
@@ -113,13 +151,26 @@ func (f fsnotifyNotifier) Events() <-chan NotificationEvent {
 }
 
 func (f fsnotifyNotifier) Add(location string) error {
-	return f.FSWatcher.Add(location)
+	if err := f.FSWatcher.Add(location); err != nil {
+		return err
+	}
+	f.watches.add(location)
+	return nil
 }
 
+// Remove the location, it is no longer counted even if it was already
+// removed from the underlying watcher.
 func (f fsnotifyNotifier) Remove(location string) error {
+	f.watches.remove(location)
 	return f.FSWatcher.Remove(location)
 }
 
+// Watches returns the number of distinct watched locations, directories
+// added on creation included.
+func (f fsnotifyNotifier) Watches() int {
+	return f.watches.len()
+}
+
 func (f fsnotifyNotifier) Close() error {
 	return f.FSWatcher.Close()
 }
@@ -129,5 +180,5 @@ func NewFSNotifyNotifier() Notifier {
 	if err != nil {
 		panic(err)
 	}
-	return fsnotifyNotifier{FSWatcher: fsw}
+	return fsnotifyNotifier{FSWatcher: fsw, watches: &watchSet{paths: make(map[string]struct{})}}
 }
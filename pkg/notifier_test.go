@@ -212,3 +212,36 @@ func (t *testNotifier) TestNotifier() {
 		})
 	})
 }
+
+func TestNotifierWatches(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	require.NoError(t, os.Mkdir(sub, 0755))
+
+	notifier := pkg.NewFSNotifyNotifier()
+	defer notifier.Close()
+	watches := notifier.(interface{ Watches() int }).Watches
+
+	require.NoError(t, notifier.Add(dir))
+	require.NoError(t, notifier.Add(dir+"/"))
+	require.NoError(t, notifier.Add(sub))
+	require.Equal(t, 2, watches(), "distinct paths")
+
+	events := notifier.Events()
+	require.NoError(t, os.Remove(sub))
+	require.Eventually(t, func() bool {
+		select {
+		case event := <-events:
+			return event.Path == sub && event.Notification&pkg.NotificationRemove != 0
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond*10)
+	require.Equal(t, 1, watches(), "removed with its directory")
+
+	// the watch is already gone.
+	_ = notifier.Remove(sub)
+	require.Equal(t, 1, watches())
+	_ = notifier.Remove(dir)
+	require.Zero(t, watches())
+}
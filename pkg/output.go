@@ -0,0 +1,232 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Output modes of a watcher: OutputStream forwards the output of commands
+// as it comes, OutputOnFailure only shows it when the run failed, and
+// OutputDiff shows what changed since the previous run.
+const (
+	OutputStream    = "stream"
+	OutputOnFailure = "on-failure"
+	OutputDiff      = "diff"
+)
+
+// DiffContext is the number of unchanged lines around changes in OutputDiff mode.
+const DiffContext = 3
+
+// RunOutput receives the standard and error outputs of the commands of a
+// watcher. It forwards them to writers, usually the terminal, and copies
+// them to the writers attached for the duration of a run.
+type RunOutput struct {
+	lock     sync.Mutex
+	stdout   io.Writer
+	stderr   io.Writer
+	attached []io.Writer
+	// held keeps outputs as records of a stream index, a length and data.
+	held      *SpillBuffer
+	heldLines int
+}
+
+const (
+	streamStdout = iota
+	streamStderr
+)
+
+func NewRunOutput(stdout, stderr io.Writer) *RunOutput {
+	return &RunOutput{stdout: stdout, stderr: stderr}
+}
+
+// Stdout returns the writer to use as standard output of commands.
+func (o *RunOutput) Stdout() io.Writer {
+	return runOutputStream{output: o, stream: streamStdout}
+}
+
+// Stderr returns the writer to use as error output of commands.
+func (o *RunOutput) Stderr() io.Writer {
+	return runOutputStream{output: o, stream: streamStderr}
+}
+
+func (o *RunOutput) writer(stream int) io.Writer {
+	if stream == streamStderr {
+		return o.stderr
+	}
+	return o.stdout
+}
+
+// write never fails because of an attached writer.
+func (o *RunOutput) write(stream int, p []byte) (int, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	for _, attached := range o.attached {
+		_, _ = attached.Write(p)
+	}
+
+	if o.held != nil {
+		record := make([]byte, 5, 5+len(p))
+		record[0] = byte(stream)
+		binary.BigEndian.PutUint32(record[1:], uint32(len(p)))
+		o.heldLines += bytes.Count(p, []byte{'\n'})
+		return o.held.Write(append(record, p...))
+	}
+
+	return o.writer(stream).Write(p)
+}
+
+// Hold keeps outputs in a SpillBuffer instead of forwarding them, until
+// Release is called. Attached writers still receive them.
+func (o *RunOutput) Hold() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.held == nil {
+		o.held = NewSpillBuffer()
+		o.heldLines = 0
+	}
+}
+
+// Release stops holding outputs. Held outputs are forwarded if show is
+// true, in the order they were written. It returns the number of lines
+// held.
+func (o *RunOutput) Release(show bool) (lines int, err error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	held := o.held
+	if held == nil {
+		return 0, nil
+	}
+
+	o.held = nil
+	defer held.Close()
+
+	if !show {
+		return o.heldLines, nil
+	}
+
+	r, err := held.Reader()
+	if err != nil {
+		return o.heldLines, err
+	}
+
+	reader := bufio.NewReader(r)
+	header := make([]byte, 5)
+
+	for {
+		if _, err := io.ReadFull(reader, header); err == io.EOF {
+			break
+		} else if err != nil {
+			return o.heldLines, fmt.Errorf("held output: %w", err)
+		}
+
+		if _, err := io.CopyN(o.writer(int(header[0])), reader, int64(binary.BigEndian.Uint32(header[1:]))); err != nil {
+			return o.heldLines, fmt.Errorf("held output: %w", err)
+		}
+	}
+
+	if dropped := held.Dropped(); dropped > 0 {
+		fmt.Fprintf(o.stderr, "[%d bytes of output dropped]\n", dropped)
+	}
+
+	return o.heldLines, nil
+}
+
+// Attach copies both outputs to w until the returned function is called.
+func (o *RunOutput) Attach(w io.Writer) (detach func()) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.attached = append(o.attached, w)
+
+	return func() {
+		o.lock.Lock()
+		defer o.lock.Unlock()
+
+		for i, attached := range o.attached {
+			if attached == w {
+				o.attached = append(o.attached[:i], o.attached[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+type runOutputStream struct {
+	output *RunOutput
+	stream int
+}
+
+func (s runOutputStream) Write(p []byte) (int, error) {
+	return s.output.write(s.stream, p)
+}
+
+// prefixColors are ANSI foreground colors given to watcher prefixes.
+var prefixColors = []int{36, 33, 32, 35, 34, 31, 96, 93, 92, 95, 94, 91}
+
+// WatcherPrefix returns [name] padded to width, in a color that only
+// depends on the name when color is true.
+func WatcherPrefix(name string, width int, color bool) string {
+	prefix := "[" + name + "]"
+	if pad := width + 2 - len(prefix); pad > 0 {
+		prefix += strings.Repeat(" ", pad)
+	}
+
+	if color {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(name))
+		prefix = fmt.Sprintf("\x1b[%dm%s\x1b[0m", prefixColors[h.Sum32()%uint32(len(prefixColors))], prefix)
+	}
+
+	return prefix + " "
+}
+
+// NewPrefixWriter writes prefix at the beginning of each line written to w.
+func NewPrefixWriter(w io.Writer, prefix string) io.Writer {
+	return &prefixWriter{w: w, prefix: []byte(prefix)}
+}
+
+type prefixWriter struct {
+	lock    sync.Mutex
+	w       io.Writer
+	prefix  []byte
+	midLine bool
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	buf := make([]byte, 0, len(b)+len(p.prefix))
+
+	for rest := b; len(rest) > 0; {
+		if !p.midLine {
+			buf = append(buf, p.prefix...)
+		}
+
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			buf = append(buf, rest...)
+			p.midLine = true
+			break
+		}
+
+		buf = append(buf, rest[:i+1]...)
+		rest = rest[i+1:]
+		p.midLine = false
+	}
+
+	if _, err := p.w.Write(buf); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
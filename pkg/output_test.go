@@ -0,0 +1,126 @@
+package pkg_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	out := bytes.Buffer{}
+	w := pkg.NewPrefixWriter(&out, pkg.WatcherPrefix("api", 8, false))
+
+	_, err := w.Write([]byte("first\nsec"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("ond\n"))
+	require.NoError(t, err)
+
+	require.Equal(t, "[api]      first\n[api]      second\n", out.String())
+
+	require.Equal(t, pkg.WatcherPrefix("api", 0, true), pkg.WatcherPrefix("api", 0, true), "stable color")
+	require.Contains(t, pkg.WatcherPrefix("api", 0, true), "\x1b[")
+}
+
+func TestRunOutputSeparateStreams(t *testing.T) {
+	stdout, stderr, captured := bytes.Buffer{}, bytes.Buffer{}, bytes.Buffer{}
+	output := pkg.NewRunOutput(&stdout, &stderr)
+
+	exec, err := pkg.NewExecutorShell(output.Stdout(), "echo out && echo err >&2", pkg.ExecOptions{ErrOutput: output.Stderr()})
+	require.NoError(t, err)
+
+	detach := output.Attach(&captured)
+	require.NoError(t, exec.Exec(pkg.NotificationEvent{}, ""))
+	detach()
+	require.NoError(t, exec.Exec(pkg.NotificationEvent{}, ""))
+
+	require.Equal(t, "out\nout\n", stdout.String())
+	require.Equal(t, "err\nerr\n", stderr.String())
+	require.Len(t, captured.String(), len("out\nerr\n"))
+}
+
+func TestRunOutputHold(t *testing.T) {
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	output := pkg.NewRunOutput(&stdout, &stderr)
+
+	output.Hold()
+	fmt.Fprintln(output.Stdout(), "out")
+	fmt.Fprintln(output.Stderr(), "err")
+	lines, err := output.Release(false)
+	require.NoError(t, err)
+	require.Equal(t, 2, lines)
+	require.Empty(t, stdout.String())
+	require.Empty(t, stderr.String())
+
+	output.Hold()
+	fmt.Fprintln(output.Stdout(), "out")
+	fmt.Fprintln(output.Stderr(), "err")
+	_, err = output.Release(true)
+	require.NoError(t, err)
+	require.Equal(t, "out\n", stdout.String())
+	require.Equal(t, "err\n", stderr.String())
+
+	fmt.Fprintln(output.Stdout(), "released")
+	require.Equal(t, "out\nreleased\n", stdout.String())
+}
+
+func TestSpillBuffer(t *testing.T) {
+	b := &pkg.SpillBuffer{MemLimit: 4, MaxSize: 10}
+	defer b.Close()
+
+	for _, s := range []string{"abc", "def", "ghi", "jkl"} {
+		_, err := b.Write([]byte(s))
+		require.NoError(t, err)
+	}
+
+	r, err := b.Reader()
+	require.NoError(t, err)
+	kept, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "abcdefghi", string(kept))
+	require.Equal(t, int64(3), b.Dropped())
+}
+
+func TestWatcherOutputDiff(t *testing.T) {
+	stdout := bytes.Buffer{}
+	output := pkg.NewRunOutput(&stdout, &stdout)
+	file := filepath.Join(t.TempDir(), "lint")
+
+	exec, err := pkg.NewExecutorShell(output.Stdout(), "cat "+file, pkg.ExecOptions{ErrOutput: output.Stderr()})
+	require.NoError(t, err)
+
+	notifier := pkg.NewFSNotifyNotifier()
+	defer notifier.Close()
+
+	w, err := pkg.NewWatcher("lint", pkg.LocalFinder{}, regexp.MustCompile(".*"), notifier, exec, pkg.SilentLogger{})
+	require.NoError(t, err)
+	w.Output = output
+	w.OutputMode = pkg.OutputDiff
+
+	require.NoError(t, os.WriteFile(file, []byte("warning 1\nwarning 2\n"), 0600))
+	require.NoError(t, w.Trigger(""))
+	require.Equal(t, "warning 1\nwarning 2\n", stdout.String(), "first run shows everything")
+
+	stdout.Reset()
+	require.NoError(t, w.Trigger(""))
+	require.Equal(t, "lint: output unchanged, 2 lines\n", stdout.String())
+
+	stdout.Reset()
+	require.NoError(t, os.WriteFile(file, []byte("warning 1\nwarning 3\n"), 0600))
+	require.NoError(t, w.Trigger(""))
+	require.Equal(t, `--- lint: previous run
++++ lint: this run
+@@ -1,2 +1,2 @@
+ warning 1
+-warning 2
++warning 3
+lint: 1 lines added, 1 lines removed
+`, stdout.String())
+}
@@ -0,0 +1,210 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultOutputFileKeep is the number of rotated output files kept.
+const DefaultOutputFileKeep = 3
+
+// OutputFileSettings tells where to write the output file and when to
+// rotate it: before a run once it reaches MaxSize bytes or holds MaxRuns
+// runs, keeping Keep rotated files as path.1, path.2... 0 disables a limit.
+type OutputFileSettings struct {
+	Path      string
+	MaxSize   int64
+	MaxRuns   int
+	Keep      int
+	StripANSI bool
+}
+
+// OutputFile appends the output of each run of a watcher to a file, between
+// a header and a footer describing the run.
+type OutputFile struct {
+	OutputFileSettings
+
+	lock sync.Mutex
+	fh   *os.File
+	size int64
+	runs int
+}
+
+func NewOutputFile(settings OutputFileSettings) *OutputFile {
+	return &OutputFile{OutputFileSettings: settings}
+}
+
+// Start opens the file, rotating it if needed, and writes the header of a
+// run. The returned writer receives the output of the run.
+func (f *OutputFile) Start(watcher string, event NotificationEvent, eventFile string) (io.Writer, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.fh != nil && ((f.MaxSize > 0 && f.size >= f.MaxSize) || (f.MaxRuns > 0 && f.runs >= f.MaxRuns)) {
+		if err := f.rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.fh == nil {
+		if err := f.open(); err != nil {
+			return nil, err
+		}
+	}
+
+	f.runs++
+
+	header := fmt.Sprintf("=== %s watcher %s: %s %s\n", time.Now().Format(time.RFC3339), watcher, event.Notification, eventFile)
+	if _, err := f.write([]byte(header)); err != nil {
+		return nil, err
+	}
+
+	if f.StripANSI {
+		return ansiStripper{w: outputFileWriter{f}}, nil
+	}
+
+	return outputFileWriter{f}, nil
+}
+
+// Finish writes the footer of a run.
+func (f *OutputFile) Finish(result RunResult) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	footer := fmt.Sprintf("=== exit code %d after %s\n", result.ExitCode, result.Duration.Round(time.Millisecond))
+	_, err := f.write([]byte(footer))
+	return err
+}
+
+func (f *OutputFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+		return fmt.Errorf("output file: %w", err)
+	}
+
+	fh, err := os.OpenFile(f.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("output file: %w", err)
+	}
+
+	fi, err := fh.Stat()
+	if err != nil {
+		fh.Close()
+		return fmt.Errorf("output file: %w", err)
+	}
+
+	f.fh = fh
+	f.size = fi.Size()
+	f.runs = 0
+
+	return nil
+}
+
+// rotate renames path.N to path.N+1, up to Keep, then path to path.1.
+func (f *OutputFile) rotate() error {
+	if err := f.fh.Close(); err != nil {
+		return fmt.Errorf("output file: %w", err)
+	}
+	f.fh = nil
+
+	if f.Keep <= 0 {
+		return os.Remove(f.Path)
+	}
+
+	_ = os.Remove(fmt.Sprintf("%s.%d", f.Path, f.Keep))
+	for i := f.Keep - 1; i > 0; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", f.Path, i), fmt.Sprintf("%s.%d", f.Path, i+1))
+	}
+
+	if err := os.Rename(f.Path, f.Path+".1"); err != nil {
+		return fmt.Errorf("output file: %w", err)
+	}
+
+	return nil
+}
+
+// write must be called with the lock held.
+func (f *OutputFile) write(p []byte) (int, error) {
+	if f.fh == nil {
+		return 0, fmt.Errorf("output file: %s: not opened", f.Path)
+	}
+
+	n, err := f.fh.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close the file, it is opened again by the next run.
+func (f *OutputFile) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.fh == nil {
+		return nil
+	}
+
+	err := f.fh.Close()
+	f.fh = nil
+	return err
+}
+
+type outputFileWriter struct {
+	f *OutputFile
+}
+
+func (w outputFileWriter) Write(p []byte) (int, error) {
+	w.f.lock.Lock()
+	defer w.f.lock.Unlock()
+	return w.f.write(p)
+}
+
+var ansiRe = regexp.MustCompile("\x1b\\[[0-9;?]*[ -/]*[@-~]|\x1b\\][^\x07\x1b]*(\x07|\x1b\\\\)")
+
+// StripANSI removes terminal escape sequences, like colors.
+func StripANSI(p []byte) []byte {
+	return ansiRe.ReplaceAll(p, nil)
+}
+
+type ansiStripper struct {
+	w io.Writer
+}
+
+func (s ansiStripper) Write(p []byte) (int, error) {
+	if _, err := s.w.Write(StripANSI(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ParseSize reads a size in bytes, with an optional K, M or G suffix for
+// powers of 1024, like 10M.
+func ParseSize(value string) (int64, error) {
+	value = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(value, "K"):
+		unit = 1 << 10
+	case strings.HasSuffix(value, "M"):
+		unit = 1 << 20
+	case strings.HasSuffix(value, "G"):
+		unit = 1 << 30
+	}
+
+	if unit > 1 {
+		value = value[:len(value)-1]
+	}
+
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("size: %w", err)
+	}
+
+	return size * unit, nil
+}
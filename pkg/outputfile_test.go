@@ -0,0 +1,118 @@
+package pkg_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+func TestOutputFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "build.log")
+	f := pkg.NewOutputFile(pkg.OutputFileSettings{Path: path, MaxRuns: 2, Keep: 1, StripANSI: true})
+	defer f.Close()
+
+	run := func(output string, exitCode int) {
+		w, err := f.Start("build", pkg.NotificationEvent{Notification: pkg.NotificationWrite}, "main.go")
+		require.NoError(t, err)
+		_, err = w.Write([]byte(output))
+		require.NoError(t, err)
+		require.NoError(t, f.Finish(pkg.RunResult{ExitCode: exitCode, Duration: time.Second}))
+	}
+
+	read := func(path string) string {
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	run("\x1b[31mfirst\x1b[0m\n", 1)
+	require.Regexp(t, `^=== \S+ watcher build: Write main.go\nfirst\n=== exit code 1 after 1s\n$`, read(path))
+
+	run("second\n", 0)
+	run("third\n", 0)
+
+	require.Contains(t, read(path+".1"), "first")
+	require.Contains(t, read(path+".1"), "second")
+	require.NotContains(t, read(path), "second")
+	require.Contains(t, read(path), "third")
+
+	run("fourth\n", 0)
+	run("fifth\n", 0)
+	require.NotContains(t, read(path+".1"), "first", "only one rotated file kept")
+	require.NoFileExists(t, path+".2")
+}
+
+func TestOutputFileShared(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := watchersFromString(t, `
+output_file = `+dir+`/%watcher.log
+
+[build]
+command = true
+
+[test]
+command = true
+`)
+	require.NoError(t, err)
+
+	_, err = watchersFromString(t, `
+[build]
+command = true
+output_file = `+dir+`/out.log
+
+[test]
+command = true
+output_file = `+dir+`/./out.log
+`)
+	require.EqualError(t, err, "conf: test: output file "+dir+"/./out.log is already written by build")
+}
+
+func TestParseSize(t *testing.T) {
+	for value, size := range map[string]int64{"512": 512, "10K": 10 << 10, "10M": 10 << 20, "1GB": 1 << 30} {
+		parsed, err := pkg.ParseSize(value)
+		require.NoError(t, err)
+		require.Equal(t, size, parsed, value)
+	}
+
+	_, err := pkg.ParseSize("ten")
+	require.Error(t, err)
+}
+
+func TestOutputFileIgnored(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "logs"), 0755))
+	runs := filepath.Join(t.TempDir(), "runs")
+
+	watchers, err := watchersFromString(t, `
+silent = true
+
+[build]
+match = `+dir+`
+output_file = `+dir+`/logs/%watcher.log
+output_file_max_runs = 1
+command = echo run >> `+runs+` && echo built
+`)
+	require.NoError(t, err)
+
+	w := watchers[0]
+	go w.Work()
+	defer w.Stop()
+	time.Sleep(time.Millisecond * 200)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), nil, 0644))
+	require.Eventually(t, func() bool { return w.State().LastRun != nil }, time.Second*5, time.Millisecond*10)
+
+	// writing and rotating the output file does not run the command again.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("\n"), 0644))
+	time.Sleep(time.Second * 2)
+	b, err := os.ReadFile(runs)
+	require.NoError(t, err)
+	require.Equal(t, "run\nrun\n", string(b))
+	require.FileExists(t, filepath.Join(dir, "logs", "build.log.1"))
+}
@@ -0,0 +1,141 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Step is a command of a pipeline.
+type Step struct {
+	Name     string
+	Executor Executor
+	// ContinueOnError runs the next steps even if this one failed, the run
+	// still fails once they are done.
+	ContinueOnError bool
+}
+
+// StepError is returned by a pipeline when one of its steps failed.
+type StepError struct {
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("step %s: %v", e.Step, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// StepErrors is returned by a pipeline when several of its steps failed,
+// the first ones being allowed to. It unwraps to the first failure, which
+// gives the exit code of the run, unless a step timed out. errors.Is and
+// errors.As look into every failure, so a step killed by its timeout or a
+// limit is seen whichever position it has.
+type StepErrors []*StepError
+
+func (e StepErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, ", ")
+}
+
+func (e StepErrors) Unwrap() error {
+	return e[0]
+}
+
+func (e StepErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e StepErrors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// stepsError returns nil, the only failure, or all of them.
+func stepsError(failed []*StepError) error {
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return failed[0]
+	default:
+		return StepErrors(failed)
+	}
+}
+
+// NewExecutorPipeline returns an executor running steps in order, stopping
+// at the first failing one not allowed to fail. Timing and status of each
+// step are logged, the failures of all steps are returned.
+func NewExecutorPipeline(name string, logger Logger, steps []Step) Executor {
+	return &pipelineExec{name: name, logger: logger, steps: steps}
+}
+
+type pipelineExec struct {
+	name      string
+	logger    Logger
+	steps     []Step
+	lock      sync.RWMutex
+	executing bool
+}
+
+func (e *pipelineExec) setExecuting(on bool) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.executing = on
+}
+
+func (e *pipelineExec) Running() bool {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return e.executing
+}
+
+func (e *pipelineExec) Exec(event NotificationEvent, eventFile string) error {
+	e.setExecuting(true)
+	defer e.setExecuting(false)
+
+	var failed []*StepError
+	for i, step := range e.steps {
+		fields := []Field{F(FieldWatcher, e.name), F("step", step.Name), F("position", fmt.Sprintf("%d/%d", i+1, len(e.steps)))}
+		e.logger.Info("running step", fields...)
+
+		start := time.Now()
+		err := step.Executor.Exec(event, eventFile)
+		fields = append(fields, F(FieldDuration, time.Since(start).Round(time.Millisecond)))
+
+		if err == nil {
+			e.logger.Info("step succeeded", fields...)
+			continue
+		}
+
+		failed = append(failed, &StepError{Step: step.Name, Err: err})
+
+		if step.ContinueOnError {
+			e.logger.Warn("step failed, continuing", append(fields, F(FieldError, err))...)
+			continue
+		}
+
+		e.logger.Warn("step failed", append(fields, F(FieldError, err))...)
+
+		return stepsError(failed)
+	}
+
+	return stepsError(failed)
+}
@@ -0,0 +1,113 @@
+package pkg_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-ini/ini"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+func TestPipelineExec(t *testing.T) {
+	out := bytes.Buffer{}
+
+	step := func(name, command string, continueOnError bool) pkg.Step {
+		exec, err := pkg.NewExecutorShell(&out, command, pkg.ExecOptions{})
+		require.NoError(t, err)
+		return pkg.Step{Name: name, Executor: exec, ContinueOnError: continueOnError}
+	}
+
+	pipeline := pkg.NewExecutorPipeline("test", pkg.SilentLogger{}, []pkg.Step{
+		step("1", "echo one", false),
+		step("2", "exit 4", true),
+		step("3", "echo three", false),
+	})
+	err := pipeline.Exec(pkg.NotificationEvent{}, "")
+	require.Error(t, err, "the run fails once the next steps ran")
+	require.Equal(t, 4, pkg.ExitCode(err))
+	require.Equal(t, "one\nthree\n", out.String())
+
+	out.Reset()
+	pipeline = pkg.NewExecutorPipeline("test", pkg.SilentLogger{}, []pkg.Step{
+		step("1", "exit 5", true),
+		step("2", "echo two", false),
+		step("3", "exit 4", false),
+		step("4", "echo four", false),
+	})
+
+	err = pipeline.Exec(pkg.NotificationEvent{}, "")
+	var stepErrs pkg.StepErrors
+	require.True(t, errors.As(err, &stepErrs))
+	require.Len(t, stepErrs, 2)
+	require.Equal(t, "step 1: exit status 5, step 3: exit status 4", err.Error())
+	require.Equal(t, 5, pkg.ExitCode(err), "exit code of the first failure")
+	require.Equal(t, "two\n", out.String())
+
+	out.Reset()
+	pipeline = pkg.NewExecutorPipeline("test", pkg.SilentLogger{}, []pkg.Step{
+		step("1", "echo one", false),
+		step("2", "exit 4", false),
+		step("3", "echo three", false),
+	})
+
+	err = pipeline.Exec(pkg.NotificationEvent{}, "")
+	var stepErr *pkg.StepError
+	require.True(t, errors.As(err, &stepErr))
+	require.Equal(t, "2", stepErr.Step)
+	require.Equal(t, 4, pkg.ExitCode(err))
+	require.Equal(t, "one\n", out.String())
+}
+
+func TestPipelineStepTimeout(t *testing.T) {
+	step := func(name, command string, opts pkg.ExecOptions, continueOnError bool) pkg.Step {
+		exec, err := pkg.NewExecutorShell(&bytes.Buffer{}, command, opts)
+		require.NoError(t, err)
+		return pkg.Step{Name: name, Executor: exec, ContinueOnError: continueOnError}
+	}
+
+	pipeline := pkg.NewExecutorPipeline("test", pkg.SilentLogger{}, []pkg.Step{
+		step("1", "exit 5", pkg.ExecOptions{}, true),
+		step("2", "sleep 5", pkg.ExecOptions{Timeout: time.Millisecond * 100, KillGrace: time.Millisecond * 100}, false),
+	})
+
+	err := pipeline.Exec(pkg.NotificationEvent{}, "")
+	require.True(t, errors.Is(err, pkg.ErrTimeout), "timeout of a later step is seen")
+	require.Equal(t, 124, pkg.ExitCode(err))
+}
+
+func TestPipelineFromConf(t *testing.T) {
+	workdir := t.TempDir()
+
+	cfg, err := ini.Load([]byte(`
+[steps]
+workdir = ` + workdir + `
+silent = true
+step.10 = echo ten >> out
+step.2 = echo two >> out
+step.2.timeout = 1s
+step.1 = echo one >> out
+step.1.executor = unixshell
+
+[both]
+command = true
+step.1 = true
+`))
+	require.NoError(t, err)
+
+	w, err := pkg.WatcherFromConf(cfg.Section("steps"), stderrLogger(t), pkg.Cfg{ExecutorName: pkg.ExecutorUnixShell}, pkg.ExecutorFromName)
+	require.NoError(t, err)
+	require.NoError(t, w.Trigger(""))
+
+	b, err := os.ReadFile(filepath.Join(workdir, "out"))
+	require.NoError(t, err)
+	require.Equal(t, "one\ntwo\nten\n", string(b))
+
+	_, err = pkg.WatcherFromConf(cfg.Section("both"), stderrLogger(t), pkg.Cfg{ExecutorName: pkg.ExecutorUnixShell}, pkg.ExecutorFromName)
+	require.Error(t, err)
+}
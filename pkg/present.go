@@ -0,0 +1,86 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Terminal escape sequences used to present runs.
+const (
+	termClear = "\x1b[H\x1b[2J\x1b[3J"
+	termBell  = "\a"
+	termBold  = "\x1b[1m"
+	termRed   = "\x1b[31m"
+	termGreen = "\x1b[32m"
+	termReset = "\x1b[0m"
+)
+
+// Presenter decorates the runs of a watcher on a terminal: Clear the screen
+// before a run, print a Banner with the file that triggered it and a footer
+// with its result, set the terminal Title to the watcher status, and ring
+// the Bell on failure.
+//
+// Banners are written to Output, escape sequences to Terminal, so they are
+// not mixed with prefixes.
+type Presenter struct {
+	Output   io.Writer
+	Terminal io.Writer
+	Clear    bool
+	Banner   bool
+	Title    bool
+	Bell     bool
+	Color    bool
+}
+
+func (p *Presenter) style(style, text string) string {
+	if !p.Color {
+		return text
+	}
+	return style + text + termReset
+}
+
+func (p *Presenter) setTitle(title string) {
+	fmt.Fprintf(p.Terminal, "\x1b]0;%s\a", title)
+}
+
+// Start is called before a run.
+func (p *Presenter) Start(watcher string, event NotificationEvent, eventFile string) {
+	if p.Clear {
+		fmt.Fprint(p.Terminal, termClear)
+	}
+
+	if p.Title {
+		p.setTitle(fmt.Sprintf("watchngo: %s running", watcher))
+	}
+
+	if p.Banner {
+		banner := fmt.Sprintf("=== %s %s: %s %s", time.Now().Format("15:04:05"), watcher, event.Notification, eventFile)
+		fmt.Fprintln(p.Output, p.style(termBold, banner))
+	}
+}
+
+// Finish is called after a run.
+func (p *Presenter) Finish(watcher string, result RunResult) {
+	status := "OK"
+	if result.Err != nil {
+		status = fmt.Sprintf("FAILED (exit code %d)", result.ExitCode)
+	}
+
+	if p.Banner {
+		footer := fmt.Sprintf("=== %s: %s in %s", watcher, status, result.Duration.Round(time.Millisecond))
+		if result.Err != nil {
+			fmt.Fprintln(p.Output, p.style(termRed, footer))
+		} else {
+			fmt.Fprintln(p.Output, p.style(termGreen, footer))
+		}
+	}
+
+	if p.Title {
+		p.setTitle(fmt.Sprintf("watchngo: %s %s", watcher, status))
+	}
+
+	if p.Bell && result.Err != nil {
+		fmt.Fprint(p.Terminal, termBell)
+	}
+}
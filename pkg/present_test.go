@@ -0,0 +1,34 @@
+package pkg_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+func TestPresenter(t *testing.T) {
+	output, terminal := bytes.Buffer{}, bytes.Buffer{}
+	p := &pkg.Presenter{Output: &output, Terminal: &terminal, Clear: true, Banner: true, Title: true, Bell: true}
+
+	p.Start("build", pkg.NotificationEvent{Notification: pkg.NotificationWrite}, "main.go")
+	require.Regexp(t, `^=== \d\d:\d\d:\d\d build: Write main.go\n$`, output.String())
+	require.Equal(t, "\x1b[H\x1b[2J\x1b[3J\x1b]0;watchngo: build running\a", terminal.String())
+
+	output.Reset()
+	terminal.Reset()
+	p.Finish("build", pkg.RunResult{Duration: time.Second})
+	require.Equal(t, "=== build: OK in 1s\n", output.String())
+	require.Equal(t, "\x1b]0;watchngo: build OK\a", terminal.String())
+
+	output.Reset()
+	terminal.Reset()
+	p.Color = true
+	p.Finish("build", pkg.RunResult{Duration: time.Second, ExitCode: 2, Err: fmt.Errorf("exit status 2")})
+	require.Equal(t, "\x1b[31m=== build: FAILED (exit code 2) in 1s\x1b[0m\n", output.String())
+	require.Equal(t, "\x1b]0;watchngo: build FAILED (exit code 2)\a\a", terminal.String())
+}
@@ -0,0 +1,282 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Diagnostic is a problem reported by a command about a file.
+type Diagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column,omitempty"`
+	Severity string `json:"severity,omitempty"`
+	Message  string `json:"message"`
+}
+
+// ProblemMatcher extracts diagnostics from the output lines of a run.
+type ProblemMatcher interface {
+	// Reset is called before each run.
+	Reset()
+	Match(line string) (Diagnostic, bool)
+}
+
+// Builtin problem matchers.
+const (
+	ProblemMatcherGo     = "go"
+	ProblemMatcherGCC    = "gcc"
+	ProblemMatcherESLint = "eslint"
+)
+
+// Default files written by Problems, %watcher is replaced with the watcher
+// name.
+const (
+	DefaultQuickfixFile    = ".watchngo/%watcher.errors"
+	DefaultDiagnosticsFile = ".watchngo/%watcher.json"
+)
+
+// NewProblemMatcher returns a builtin problem matcher, or one using name as
+// a regular expression with named groups: file and line are required, col,
+// severity and message are optional.
+func NewProblemMatcher(name string) (ProblemMatcher, error) {
+	switch name {
+	case ProblemMatcherGo:
+		return newRegexpMatcher(`^\s*(?P<file>[^\s:]+\.go):(?P<line>\d+):(?:(?P<col>\d+):)?\s*(?P<message>.+)$`)
+	case ProblemMatcherGCC:
+		return newRegexpMatcher(`^(?P<file>[^\s:]+):(?P<line>\d+):(?:(?P<col>\d+):)?\s*(?P<severity>fatal error|error|warning|note):\s*(?P<message>.+)$`)
+	case ProblemMatcherESLint:
+		return &eslintMatcher{}, nil
+	default:
+		return newRegexpMatcher(name)
+	}
+}
+
+type regexpMatcher struct {
+	re *regexp.Regexp
+}
+
+func newRegexpMatcher(expr string) (ProblemMatcher, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("problem matcher: %w", err)
+	}
+
+	if re.SubexpIndex("file") < 0 || re.SubexpIndex("line") < 0 {
+		return nil, fmt.Errorf("problem matcher: %s: file and line named groups are required", expr)
+	}
+
+	return regexpMatcher{re: re}, nil
+}
+
+func (m regexpMatcher) Reset() {}
+
+func (m regexpMatcher) Match(line string) (Diagnostic, bool) {
+	match := m.re.FindStringSubmatch(line)
+	if match == nil {
+		return Diagnostic{}, false
+	}
+
+	group := func(name string) string {
+		if i := m.re.SubexpIndex(name); i >= 0 {
+			return match[i]
+		}
+		return ""
+	}
+
+	d := Diagnostic{
+		File:     group("file"),
+		Severity: group("severity"),
+		Message:  strings.TrimSpace(group("message")),
+	}
+	d.Line, _ = strconv.Atoi(group("line"))
+	d.Column, _ = strconv.Atoi(group("col"))
+
+	return d, true
+}
+
+var (
+	eslintLocationRe = regexp.MustCompile(`^\s+(\d+):(\d+)\s+(error|warning)\s+(.+?)(?:\s{2,}(\S+))?$`)
+	eslintUnixRe     = regexp.MustCompile(`^([^\s:]+):(\d+):(\d+):\s*(.+?)(?:\s+\[(Error|Warning)/(\S+)\])?$`)
+)
+
+// eslintMatcher reads the default stylish format, where a file name is
+// followed by indented problems, and the unix format.
+type eslintMatcher struct {
+	file string
+}
+
+func (m *eslintMatcher) Reset() {
+	m.file = ""
+}
+
+func (m *eslintMatcher) Match(line string) (Diagnostic, bool) {
+	if match := eslintLocationRe.FindStringSubmatch(line); match != nil && m.file != "" {
+		d := Diagnostic{File: m.file, Severity: match[3], Message: match[4]}
+		if match[5] != "" {
+			d.Message += " (" + match[5] + ")"
+		}
+		d.Line, _ = strconv.Atoi(match[1])
+		d.Column, _ = strconv.Atoi(match[2])
+		return d, true
+	}
+
+	if match := eslintUnixRe.FindStringSubmatch(line); match != nil {
+		d := Diagnostic{File: match[1], Severity: strings.ToLower(match[5]), Message: match[4]}
+		d.Line, _ = strconv.Atoi(match[2])
+		d.Column, _ = strconv.Atoi(match[3])
+		return d, true
+	}
+
+	if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(line, " ") && !strings.Contains(trimmed, " ") {
+		m.file = trimmed
+	}
+
+	return Diagnostic{}, false
+}
+
+// Problems collects diagnostics from the output of each run, then writes
+// them to a quickfix file, using the %f:%l:%c: %m Vim errorformat, and to a
+// JSON file. Relative file paths are resolved from WorkDir.
+type Problems struct {
+	Matcher      ProblemMatcher
+	WorkDir      string
+	QuickfixFile string
+	JSONFile     string
+
+	lock        sync.Mutex
+	partial     []byte
+	diagnostics []Diagnostic
+}
+
+// Start resets diagnostics, the output of the run must then be written to
+// Problems.
+func (p *Problems) Start() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.Matcher.Reset()
+	p.partial = nil
+	p.diagnostics = make([]Diagnostic, 0)
+}
+
+func (p *Problems) match(line []byte) {
+	d, ok := p.Matcher.Match(string(StripANSI(bytes.TrimRight(line, "\r\n"))))
+	if !ok {
+		return
+	}
+
+	if p.WorkDir != "" && !filepath.IsAbs(d.File) {
+		d.File = filepath.Join(p.WorkDir, d.File)
+	}
+
+	p.diagnostics = append(p.diagnostics, d)
+}
+
+func (p *Problems) Write(b []byte) (int, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	data := append(p.partial, b...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		p.match(data[:i])
+		data = data[i+1:]
+	}
+	p.partial = append([]byte(nil), data...)
+
+	return len(b), nil
+}
+
+// Diagnostics returns the diagnostics found so far.
+func (p *Problems) Diagnostics() []Diagnostic {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]Diagnostic(nil), p.diagnostics...)
+}
+
+// Finish writes the diagnostics of the run to the files.
+func (p *Problems) Finish(watcher string, result RunResult) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.partial) > 0 {
+		p.match(p.partial)
+		p.partial = nil
+	}
+
+	if p.QuickfixFile != "" {
+		qf := bytes.Buffer{}
+		for _, d := range p.diagnostics {
+			message := d.Message
+			if d.Severity != "" {
+				message = d.Severity + ": " + message
+			}
+			fmt.Fprintf(&qf, "%s:%d:%d: %s\n", d.File, d.Line, d.Column, message)
+		}
+
+		if err := writeFile(p.QuickfixFile, qf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	if p.JSONFile != "" {
+		report, err := json.MarshalIndent(struct {
+			Watcher     string       `json:"watcher"`
+			Date        time.Time    `json:"date"`
+			ExitCode    int          `json:"exit_code"`
+			Diagnostics []Diagnostic `json:"diagnostics"`
+		}{watcher, time.Now(), result.ExitCode, p.diagnostics}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("problems: %w", err)
+		}
+
+		if err := writeFile(p.JSONFile, append(report, '\n')); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeFile replaces the file at once, so readers never see it partially
+// written.
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+
+	fh, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+
+	if _, err := fh.Write(data); err != nil {
+		fh.Close()
+		os.Remove(fh.Name())
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+
+	if err := fh.Close(); err != nil {
+		os.Remove(fh.Name())
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+
+	if err := os.Rename(fh.Name(), path); err != nil {
+		os.Remove(fh.Name())
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package pkg_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+func TestProblemMatchers(t *testing.T) {
+	for name, tc := range map[string]struct {
+		output      string
+		diagnostics []pkg.Diagnostic
+	}{
+		pkg.ProblemMatcherGo: {
+			output: "# github.com/Leryan/watchngo/pkg\npkg/conf.go:12:3: undefined: foo\n--- FAIL: TestX (0.00s)\n    conf_test.go:40: expected 1\n",
+			diagnostics: []pkg.Diagnostic{
+				{File: "pkg/conf.go", Line: 12, Column: 3, Message: "undefined: foo"},
+				{File: "conf_test.go", Line: 40, Message: "expected 1"},
+			},
+		},
+		pkg.ProblemMatcherGCC: {
+			output: "main.c: In function 'main':\nmain.c:4:5: warning: unused variable 'x'\nmain.c:7:1: error: expected ';'\n",
+			diagnostics: []pkg.Diagnostic{
+				{File: "main.c", Line: 4, Column: 5, Severity: "warning", Message: "unused variable 'x'"},
+				{File: "main.c", Line: 7, Column: 1, Severity: "error", Message: "expected ';'"},
+			},
+		},
+		pkg.ProblemMatcherESLint: {
+			output: "\n/src/app.js\n  1:10  error  'x' is defined but never used  no-unused-vars\n\n/src/lib.js:2:1: Missing semicolon. [Warning/semi]\n\n✖ 2 problems (1 error, 1 warning)\n",
+			diagnostics: []pkg.Diagnostic{
+				{File: "/src/app.js", Line: 1, Column: 10, Severity: "error", Message: "'x' is defined but never used (no-unused-vars)"},
+				{File: "/src/lib.js", Line: 2, Column: 1, Severity: "warning", Message: "Missing semicolon."},
+			},
+		},
+		`^(?P<file>\S+) line (?P<line>\d+): (?P<message>.*)$`: {
+			output: "a.txt line 3: too long\nok\n",
+			diagnostics: []pkg.Diagnostic{
+				{File: "a.txt", Line: 3, Message: "too long"},
+			},
+		},
+	} {
+		matcher, err := pkg.NewProblemMatcher(name)
+		require.NoError(t, err, name)
+
+		p := &pkg.Problems{Matcher: matcher}
+		p.Start()
+		_, err = p.Write([]byte(tc.output))
+		require.NoError(t, err)
+		require.Equal(t, tc.diagnostics, p.Diagnostics(), name)
+	}
+
+	_, err := pkg.NewProblemMatcher(`^(?P<message>.*)$`)
+	require.Error(t, err, "file and line groups are required")
+}
+
+func TestProblemsFiles(t *testing.T) {
+	dir := t.TempDir()
+	matcher, err := pkg.NewProblemMatcher(pkg.ProblemMatcherGo)
+	require.NoError(t, err)
+
+	p := &pkg.Problems{
+		Matcher:      matcher,
+		WorkDir:      "/src",
+		QuickfixFile: filepath.Join(dir, "qf", "build.errors"),
+		JSONFile:     filepath.Join(dir, "build.json"),
+	}
+
+	p.Start()
+	_, _ = p.Write([]byte("main.go:3:"))
+	_, _ = p.Write([]byte("1: syntax error\n/abs/x.go:1:1: bad"))
+	require.NoError(t, p.Finish("build", pkg.RunResult{ExitCode: 2}))
+
+	qf, err := os.ReadFile(p.QuickfixFile)
+	require.NoError(t, err)
+	require.Equal(t, "/src/main.go:3:1: syntax error\n/abs/x.go:1:1: bad\n", string(qf))
+
+	var report struct {
+		Watcher     string
+		ExitCode    int `json:"exit_code"`
+		Diagnostics []pkg.Diagnostic
+	}
+	b, err := os.ReadFile(p.JSONFile)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(b, &report))
+	require.Equal(t, "build", report.Watcher)
+	require.Equal(t, 2, report.ExitCode)
+	require.Len(t, report.Diagnostics, 2)
+
+	p.Start()
+	require.NoError(t, p.Finish("build", pkg.RunResult{}))
+	qf, err = os.ReadFile(p.QuickfixFile)
+	require.NoError(t, err)
+	require.Empty(t, qf, "files are replaced after each run")
+}
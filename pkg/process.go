@@ -0,0 +1,40 @@
+package pkg
+
+import (
+	"errors"
+	"os/exec"
+	"sync"
+)
+
+// ErrTimeout is returned, wrapped, by executors when a command did not finish
+// before its timeout and had to be killed.
+var ErrTimeout = errors.New("command timed out")
+
+// processes keeps track of running commands, so they can be stopped when
+// watchngo exits: being in their own process group, they do not receive
+// signals sent by the terminal.
+var processes = struct {
+	sync.Mutex
+	cmds map[*exec.Cmd]struct{}
+}{cmds: make(map[*exec.Cmd]struct{})}
+
+func trackProcess(cmd *exec.Cmd) {
+	processes.Lock()
+	defer processes.Unlock()
+	processes.cmds[cmd] = struct{}{}
+}
+
+func untrackProcess(cmd *exec.Cmd) {
+	processes.Lock()
+	defer processes.Unlock()
+	delete(processes.cmds, cmd)
+}
+
+// TerminateProcesses asks every running command and its children to stop.
+func TerminateProcesses() {
+	processes.Lock()
+	defer processes.Unlock()
+	for cmd := range processes.cmds {
+		_ = terminateProcessGroup(cmd)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package pkg
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup does nothing, only the command itself will be signalled.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
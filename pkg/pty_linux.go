@@ -0,0 +1,115 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// Size of the pseudo-terminal when watchngo does not run in a terminal.
+const (
+	defaultPTYRows = 24
+	defaultPTYCols = 80
+)
+
+type winsize struct {
+	Row, Col, Xpixel, Ypixel uint16
+}
+
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// openPTY returns the master and slave sides of a new pseudo-terminal.
+func openPTY() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("pty: %w", err)
+	}
+
+	var unlock int32
+	var n uint32
+	if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("pty: unlock: %w", err)
+	}
+
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("pty: number: %w", err)
+	}
+
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("pty: %w", err)
+	}
+
+	// keep \n line endings in the output, as with other executors.
+	var termios syscall.Termios
+	if err := ioctl(slave, syscall.TCGETS, unsafe.Pointer(&termios)); err == nil {
+		termios.Oflag &^= syscall.ONLCR
+		_ = ioctl(slave, syscall.TCSETS, unsafe.Pointer(&termios))
+	}
+
+	return master, slave, nil
+}
+
+// resizePTY copies the size of the terminal watchngo runs in.
+func resizePTY(master *os.File) {
+	ws := winsize{Row: defaultPTYRows, Col: defaultPTYCols}
+	for _, f := range []*os.File{os.Stdout, os.Stderr, os.Stdin} {
+		var size winsize
+		if err := ioctl(f, syscall.TIOCGWINSZ, unsafe.Pointer(&size)); err == nil && size.Row > 0 && size.Col > 0 {
+			ws = size
+			break
+		}
+	}
+	_ = ioctl(master, syscall.TIOCSWINSZ, unsafe.Pointer(&ws))
+}
+
+// ptyCommand runs cmd in a new session, with the slave side of a new
+// pseudo-terminal as its controlling terminal and standard streams. The
+// caller must close the slave once the command started, and call stop
+// once it exited.
+func ptyCommand(cmd *exec.Cmd) (master, slave *os.File, stop func(), err error) {
+	if master, slave, err = openPTY(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	resizePTY(master)
+
+	winch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(winch, syscall.SIGWINCH)
+	go func() {
+		for {
+			select {
+			case <-winch:
+				resizePTY(master)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = slave
+	// the session leader also leads its process group, so the whole group
+	// is still signalled on timeout.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+
+	stop = func() {
+		signal.Stop(winch)
+		close(done)
+	}
+
+	return master, slave, stop, nil
+}
@@ -0,0 +1,65 @@
+package pkg_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+func TestPTYExec(t *testing.T) {
+	out := bytes.Buffer{}
+
+	exec, err := pkg.ExecutorFromName(pkg.ExecutorPTY, "test -t 1 && test -t 2 && echo tty %event.file && stty size && echo err >&2", pkg.ExecOptions{Output: &out})
+	require.NoError(t, err)
+	require.NoError(t, exec.Exec(pkg.NotificationEvent{}, "main.go"))
+	require.Equal(t, "tty main.go\n24 80\nerr\n", out.String(), "default size when not run in a terminal")
+
+	exec, err = pkg.NewExecutorPTY(&out, "exit 3", pkg.ExecOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 3, pkg.ExitCode(exec.Exec(pkg.NotificationEvent{}, "none")))
+}
+
+func TestPTYExecRunning(t *testing.T) {
+	out := bytes.Buffer{}
+
+	exec, err := pkg.NewExecutorPTY(&out, "sleep 0.5", pkg.ExecOptions{})
+	require.NoError(t, err)
+	require.False(t, exec.Running())
+
+	done := make(chan error, 1)
+	go func() { done <- exec.Exec(pkg.NotificationEvent{}, "none") }()
+
+	time.Sleep(time.Millisecond * 100)
+	require.True(t, exec.Running())
+	require.NoError(t, <-done)
+	require.False(t, exec.Running())
+
+	exec, err = pkg.NewExecutorPTY(&out, "sleep 5 & sleep 5; wait", pkg.ExecOptions{
+		Timeout:   time.Millisecond * 200,
+		KillGrace: time.Millisecond * 200,
+	})
+	require.NoError(t, err)
+
+	start := time.Now()
+	err = exec.Exec(pkg.NotificationEvent{}, "none")
+	require.True(t, errors.Is(err, pkg.ErrTimeout), "timeout error: %v", err)
+	require.Less(t, int64(time.Since(start)), int64(time.Second*2))
+}
+
+func TestIsTerminal(t *testing.T) {
+	null, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer null.Close()
+	require.False(t, pkg.IsTerminal(null), "a character device but not a terminal")
+
+	ptmx, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	require.NoError(t, err)
+	defer ptmx.Close()
+	require.True(t, pkg.IsTerminal(ptmx))
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package pkg
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+func ptyCommand(cmd *exec.Cmd) (master, slave *os.File, stop func(), err error) {
+	return nil, nil, nil, errors.New("pty: only supported on Linux")
+}
@@ -0,0 +1,92 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Default delays between retries of a failed command.
+const (
+	DefaultRetryMinBackoff = time.Second
+	DefaultRetryMaxBackoff = time.Second * 30
+)
+
+// RetryPolicy tells how many times a failed command is run again, waiting
+// MinBackoff before the first retry and doubling the delay for each next
+// one, up to MaxBackoff.
+type RetryPolicy struct {
+	Retries    int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Backoff returns the delay to wait before the given retry, starting at 1.
+func (r RetryPolicy) Backoff(retry int) time.Duration {
+	delay := r.MinBackoff
+	for i := 1; i < retry && delay < r.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > r.MaxBackoff {
+		delay = r.MaxBackoff
+	}
+
+	return delay
+}
+
+// ParseBackoff reads a backoff range as min..max, like 1s..30s. A single
+// duration gives a constant delay.
+func ParseBackoff(value string) (min time.Duration, max time.Duration, err error) {
+	bounds := strings.SplitN(value, "..", 2)
+
+	if min, err = time.ParseDuration(strings.TrimSpace(bounds[0])); err != nil {
+		return 0, 0, fmt.Errorf("backoff: %w", err)
+	}
+
+	max = min
+	if len(bounds) == 2 {
+		if max, err = time.ParseDuration(strings.TrimSpace(bounds[1])); err != nil {
+			return 0, 0, fmt.Errorf("backoff: %w", err)
+		}
+	}
+
+	if min < 0 || max < min {
+		return 0, 0, fmt.Errorf("backoff: invalid range %s", value)
+	}
+
+	return min, max, nil
+}
+
+// Breaker counts consecutive failed runs of a watcher, it opens once
+// Threshold is reached. A Threshold of 0 disables it.
+type Breaker struct {
+	Threshold int
+	failures  int
+}
+
+// Record the result of a run and returns true if the breaker is open.
+func (b *Breaker) Record(err error) bool {
+	if err == nil {
+		b.failures = 0
+	} else {
+		b.failures++
+	}
+
+	return b.Open()
+}
+
+// Open returns true when the threshold of consecutive failures is reached.
+func (b *Breaker) Open() bool {
+	return b.Threshold > 0 && b.failures >= b.Threshold
+}
+
+// Failures returns the number of consecutive failed runs.
+func (b *Breaker) Failures() int {
+	return b.failures
+}
+
+// Reset closes the breaker.
+func (b *Breaker) Reset() {
+	b.failures = 0
+}
@@ -1,7 +1,7 @@
 package pkg
 
 import (
-	"log"
+	"fmt"
 	"sync"
 )
 
@@ -13,10 +13,99 @@ func RunForever(watchers []*Watcher) {
 		go func(w *Watcher) {
 			defer wg.Done()
 			if err := w.Work(); err != nil {
-				log.Printf("watcher returned with error: %v", err)
+				w.Logger.Error("watcher returned with error", F(FieldWatcher, w.Name), F(FieldError, err))
 			}
 		}(watcher)
 	}
 
 	wg.Wait()
 }
+
+// Runner runs watchers, and replaces them with new ones on Reload.
+type Runner struct {
+	load func() ([]*Watcher, error)
+
+	reload     sync.Mutex
+	lock       sync.Mutex
+	watchers   []*Watcher
+	generation int
+	// stopped is closed once the watchers of the running generation
+	// returned.
+	stopped chan struct{}
+}
+
+// NewRunner loads the watchers, load is called again by Reload.
+func NewRunner(load func() ([]*Watcher, error)) (*Runner, error) {
+	watchers, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Runner{load: load, watchers: watchers}, nil
+}
+
+// Watchers returns the current watchers.
+func (r *Runner) Watchers() []*Watcher {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.watchers
+}
+
+// Run the watchers until they return without being replaced by Reload.
+func (r *Runner) Run() {
+	for {
+		r.lock.Lock()
+		watchers, generation := r.watchers, r.generation
+		stopped := make(chan struct{})
+		r.stopped = stopped
+		r.lock.Unlock()
+
+		RunForever(watchers)
+		close(stopped)
+
+		r.lock.Lock()
+		replaced := r.generation != generation
+		r.lock.Unlock()
+
+		if !replaced {
+			return
+		}
+	}
+}
+
+// Reload loads new watchers and runs them once the current ones stopped.
+// Running commands are terminated and breakers are reset. The current
+// watchers are kept when the new ones cannot be loaded.
+func (r *Runner) Reload() error {
+	r.reload.Lock()
+	defer r.reload.Unlock()
+
+	watchers, err := r.load()
+	if err != nil {
+		return fmt.Errorf("reload: %w", err)
+	}
+
+	r.lock.Lock()
+	previous, stopped := r.watchers, r.stopped
+	r.watchers = watchers
+	r.generation++
+	r.lock.Unlock()
+
+	for _, w := range previous {
+		w.Stop()
+	}
+	TerminateProcesses()
+
+	if stopped != nil {
+		<-stopped
+	}
+
+	// the new watchers start with their breaker closed.
+	for _, w := range previous {
+		if w.Breaker.Open() {
+			w.Logger.Info("breaker reset by the configuration reload", F(FieldWatcher, w.Name))
+		}
+	}
+
+	return nil
+}
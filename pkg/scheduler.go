@@ -0,0 +1,172 @@
+package pkg
+
+import (
+	"sync"
+)
+
+// Scheduler limits the number of commands running at once across watchers,
+// globally and per named pool. Waiting commands are started in order of
+// arrival, unless their pool is full.
+type Scheduler struct {
+	lock    sync.Mutex
+	maxJobs int
+	jobs    int
+	pools   map[string]*jobPool
+	queue   []*job
+}
+
+type jobPool struct {
+	size int
+	jobs int
+}
+
+type job struct {
+	watcher string
+	pool    string
+	start   chan struct{}
+}
+
+// NewScheduler returns a scheduler running up to maxJobs commands at once,
+// and up to the given size for each pool. 0 means no limit.
+func NewScheduler(maxJobs int, pools map[string]int) *Scheduler {
+	s := &Scheduler{maxJobs: maxJobs, pools: make(map[string]*jobPool)}
+	for name, size := range pools {
+		s.pools[name] = &jobPool{size: size}
+	}
+	return s
+}
+
+// HasPool returns true if the pool was given to NewScheduler.
+func (s *Scheduler) HasPool(name string) bool {
+	_, ok := s.pools[name]
+	return ok
+}
+
+func (s *Scheduler) canStart(j *job) bool {
+	if s.maxJobs > 0 && s.jobs >= s.maxJobs {
+		return false
+	}
+
+	if p, ok := s.pools[j.pool]; ok && p.size > 0 && p.jobs >= p.size {
+		return false
+	}
+
+	return true
+}
+
+// schedule starts waiting jobs while slots are free. Lock must be held.
+func (s *Scheduler) schedule() {
+	queue := s.queue[:0]
+
+	for _, j := range s.queue {
+		if !s.canStart(j) {
+			queue = append(queue, j)
+			continue
+		}
+
+		s.jobs++
+		if p, ok := s.pools[j.pool]; ok {
+			p.jobs++
+		}
+		close(j.start)
+	}
+
+	s.queue = queue
+}
+
+// Acquire blocks until a command of the watcher can run in the pool, which
+// can be empty. The returned function must be called once it finished.
+func (s *Scheduler) Acquire(watcher, pool string, logger Logger) (release func()) {
+	j := &job{watcher: watcher, pool: pool, start: make(chan struct{})}
+
+	s.lock.Lock()
+	s.queue = append(s.queue, j)
+	s.schedule()
+
+	select {
+	case <-j.start:
+	default:
+		fields := []Field{F(FieldWatcher, watcher), F("queue_position", len(s.queue))}
+		if pool != "" {
+			fields = append(fields, F("pool", pool))
+		}
+		logger.Info("waiting for a job slot", fields...)
+	}
+	s.lock.Unlock()
+
+	<-j.start
+
+	return func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		s.jobs--
+		if p, ok := s.pools[j.pool]; ok {
+			p.jobs--
+		}
+		s.schedule()
+	}
+}
+
+// NewExecutorScheduled runs commands of executor once the scheduler gives
+// them a slot. It is reported as running while waiting for one, so events
+// received in the meantime are coalesced into the waiting run.
+func NewExecutorScheduled(scheduler *Scheduler, watcher, pool string, executor Executor, logger Logger) Executor {
+	return &scheduledExec{
+		scheduler: scheduler,
+		watcher:   watcher,
+		pool:      pool,
+		executor:  executor,
+		logger:    logger,
+	}
+}
+
+type scheduledExec struct {
+	scheduler *Scheduler
+	watcher   string
+	pool      string
+	executor  Executor
+	logger    Logger
+	lock      sync.RWMutex
+	// busy is true from the moment a slot is asked for until the command
+	// finished.
+	busy bool
+}
+
+func (e *scheduledExec) setBusy(on bool) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.busy = on
+}
+
+func (e *scheduledExec) Running() bool {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return e.busy || e.executor.Running()
+}
+
+// Stop is forwarded to services, so Watcher.Stop stops them.
+func (e *scheduledExec) Stop() {
+	if service, ok := e.executor.(interface{ Stop() }); ok {
+		service.Stop()
+	}
+}
+
+// OnCrash is forwarded to services, their restarts are scheduled as any run.
+func (e *scheduledExec) OnCrash(crashed func(event NotificationEvent, eventFile string)) {
+	if service, ok := e.executor.(interface {
+		OnCrash(func(NotificationEvent, string))
+	}); ok {
+		service.OnCrash(crashed)
+	}
+}
+
+func (e *scheduledExec) Exec(event NotificationEvent, eventFile string) error {
+	e.setBusy(true)
+	defer e.setBusy(false)
+
+	release := e.scheduler.Acquire(e.watcher, e.pool, e.logger)
+	defer release()
+
+	return e.executor.Exec(event, eventFile)
+}
@@ -0,0 +1,64 @@
+package pkg_test
+
+import (
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+// runConcurrently executes each executor in its own goroutine and returns
+// how long it took for all of them to finish.
+func runConcurrently(executors ...pkg.Executor) time.Duration {
+	wg := sync.WaitGroup{}
+	start := time.Now()
+
+	for _, e := range executors {
+		wg.Add(1)
+		go func(e pkg.Executor) {
+			defer wg.Done()
+			_ = e.Exec(pkg.NotificationEvent{}, "")
+		}(e)
+	}
+
+	wg.Wait()
+
+	return time.Since(start)
+}
+
+func TestScheduler(t *testing.T) {
+	sleep := func(scheduler *pkg.Scheduler, watcher, pool string) pkg.Executor {
+		exec, err := pkg.NewExecutorShell(ioutil.Discard, "sleep 0.2", pkg.ExecOptions{})
+		require.NoError(t, err)
+		return pkg.NewExecutorScheduled(scheduler, watcher, pool, exec, pkg.SilentLogger{})
+	}
+
+	scheduler := pkg.NewScheduler(1, nil)
+	require.GreaterOrEqual(t, int64(runConcurrently(
+		sleep(scheduler, "a", ""),
+		sleep(scheduler, "b", ""),
+	)), int64(time.Millisecond*400), "one job at a time")
+
+	scheduler = pkg.NewScheduler(0, map[string]int{"cpu": 1, "io": 0})
+	elapsed := runConcurrently(
+		sleep(scheduler, "a", "cpu"),
+		sleep(scheduler, "b", "cpu"),
+		sleep(scheduler, "c", "io"),
+		sleep(scheduler, "d", ""),
+	)
+	require.GreaterOrEqual(t, int64(elapsed), int64(time.Millisecond*400), "one job at a time in the cpu pool")
+	require.Less(t, int64(elapsed), int64(time.Millisecond*600), "other jobs run meanwhile")
+
+	scheduler = pkg.NewScheduler(1, nil)
+	running := sleep(scheduler, "a", "")
+	waiting := sleep(scheduler, "b", "")
+	go func() { _ = running.Exec(pkg.NotificationEvent{}, "") }()
+	time.Sleep(time.Millisecond * 50)
+	go func() { _ = waiting.Exec(pkg.NotificationEvent{}, "") }()
+	time.Sleep(time.Millisecond * 50)
+	require.True(t, waiting.Running(), "waiting for a slot counts as running")
+}
@@ -0,0 +1,372 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Watcher modes: commands run to completion on changes, services are started
+// with the watcher and restarted on changes.
+const (
+	ModeCommand = "command"
+	ModeService = "service"
+)
+
+// DefaultReadyTimeout is how long a service has to become ready.
+const DefaultReadyTimeout = time.Second * 30
+
+// ServiceOptions tell when a service is ready and how it is restarted.
+type ServiceOptions struct {
+	// ReadyTCP is an address accepting connections once ready, like :8080.
+	ReadyTCP string
+	// ReadyHTTP is an URL answering with a 2xx or 3xx status once ready.
+	ReadyHTTP string
+	// ReadyOutput matches an output line printed once ready.
+	ReadyOutput *regexp.Regexp
+	// ReadyTimeout defaults to DefaultReadyTimeout.
+	ReadyTimeout time.Duration
+	// Restart backoff after a crash, its Retries are ignored: services are
+	// always restarted. The backoff is reset once a service stayed up for
+	// Restart.MaxBackoff.
+	Restart RetryPolicy
+}
+
+// NewExecutorService returns an executor keeping the command running through
+// the shell, as NewExecutorShell does. Exec stops the running command, if any,
+// starts it again and returns once it is ready. Running returns true only
+// while it is starting, so changes keep restarting it. Crashed commands are
+// restarted after a backoff, see OnCrash.
+func NewExecutorService(name string, output io.Writer, commandTemplate string, opts ExecOptions, service ServiceOptions, logger Logger) (Executor, error) {
+	shellExec, err := NewExecutorShell(output, commandTemplate, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if service.ReadyTimeout <= 0 {
+		service.ReadyTimeout = DefaultReadyTimeout
+	}
+
+	shell := shellExec.(*unixShellExec)
+
+	return &serviceExec{
+		name:            name,
+		commandTemplate: commandTemplate,
+		shell:           shell.shell,
+		opts:            shell.rawExec.opts,
+		output:          shell.rawExec.output,
+		errOutput:       shell.rawExec.errOutput,
+		service:         service,
+		logger:          logger,
+	}, nil
+}
+
+type serviceExec struct {
+	name            string
+	commandTemplate string
+	shell           []string
+	opts            ExecOptions
+	output          io.Writer
+	errOutput       io.Writer
+	service         ServiceOptions
+	logger          Logger
+
+	lock     sync.Mutex
+	starting bool
+	// generation changes on each Exec, so a pending restart of a crashed
+	// process knows it was replaced.
+	generation int
+	process    *serviceProcess
+	// crashed, if set, restarts a crashed process through Exec, restarts
+	// then counts the restarts in a row for the next crash.
+	crashed  func(event NotificationEvent, eventFile string)
+	restarts int
+}
+
+type serviceProcess struct {
+	cmd     *exec.Cmd
+	started time.Time
+	// exited is closed once the process and its outputs are done, err is
+	// then set.
+	exited   chan struct{}
+	err      error
+	stopping bool
+	// ready is closed when the output matched ReadyOutput.
+	ready     chan struct{}
+	readyOnce sync.Once
+}
+
+func (e *serviceExec) Running() bool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.starting
+}
+
+func (e *serviceExec) setStarting(on bool) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.starting = on
+}
+
+func (e *serviceExec) Exec(event NotificationEvent, eventFile string) error {
+	e.setStarting(true)
+	defer e.setStarting(false)
+
+	e.lock.Lock()
+	e.generation++
+	generation := e.generation
+	previous := e.process
+	attempt := e.restarts
+	e.restarts = 0
+	e.lock.Unlock()
+
+	if previous != nil {
+		e.stop(previous)
+	}
+
+	p, err := e.start(generation, event, eventFile, attempt)
+	if err != nil {
+		return err
+	}
+
+	return e.waitReady(p)
+}
+
+// Stop the service, it is started again by the next Exec.
+func (e *serviceExec) Stop() {
+	e.lock.Lock()
+	e.generation++
+	p := e.process
+	e.process = nil
+	e.lock.Unlock()
+
+	if p != nil {
+		e.stop(p)
+	}
+}
+
+// OnCrash makes crashed restart the service once the backoff elapsed, in
+// place of the service itself, so the restart is run and reported as any
+// other by calling Exec.
+func (e *serviceExec) OnCrash(crashed func(event NotificationEvent, eventFile string)) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.crashed = crashed
+}
+
+// start the command and supervise it, restarting it with a backoff when it
+// exits unless it was stopped or replaced. attempt counts restarts in a row.
+func (e *serviceExec) start(generation int, event NotificationEvent, eventFile string, attempt int) (*serviceProcess, error) {
+	params := append(append([]string{}, e.shell...), MakeCommand(e.commandTemplate, event, eventFile))
+
+	p := &serviceProcess{
+		cmd:    exec.Command(params[0], params[1:]...),
+		exited: make(chan struct{}),
+		ready:  make(chan struct{}),
+	}
+
+	p.cmd.Dir = e.opts.WorkDir
+	if len(e.opts.Env) > 0 {
+		p.cmd.Env = append(os.Environ(), e.opts.Env...)
+	}
+	setProcessGroup(p.cmd)
+
+	rpOut, wpOut := io.Pipe()
+	rpErr, wpErr := io.Pipe()
+	p.cmd.Stdout = wpOut
+	p.cmd.Stderr = wpErr
+
+	limited, err := prepareLimits(p.cmd, e.opts.Limits, e.opts.Logger)
+	if err != nil {
+		return nil, err
+	}
+
+	e.lock.Lock()
+	if e.generation != generation {
+		e.lock.Unlock()
+		return nil, limited(fmt.Errorf("service %s: replaced", e.name))
+	}
+	if err := p.cmd.Start(); err != nil {
+		e.lock.Unlock()
+		return nil, limited(err)
+	}
+	p.started = time.Now()
+	e.process = p
+	e.lock.Unlock()
+
+	trackProcess(p.cmd)
+
+	copied := &sync.WaitGroup{}
+	copied.Add(2)
+	go func() {
+		copyLines(io.MultiWriter(e.output, readyWriter{p, e.service.ReadyOutput}), rpOut)
+		copied.Done()
+	}()
+	go func() {
+		copyLines(io.MultiWriter(e.errOutput, readyWriter{p, e.service.ReadyOutput}), rpErr)
+		copied.Done()
+	}()
+
+	go func() {
+		err := limited(p.cmd.Wait())
+		untrackProcess(p.cmd)
+		wpOut.Close()
+		wpErr.Close()
+		copied.Wait()
+
+		e.lock.Lock()
+		p.err = err
+		stopping := p.stopping
+		e.lock.Unlock()
+		close(p.exited)
+
+		if !stopping {
+			e.restart(p, generation, event, eventFile, attempt)
+		}
+	}()
+
+	return p, nil
+}
+
+// restart a crashed process after a backoff, through the OnCrash callback
+// if any.
+func (e *serviceExec) restart(p *serviceProcess, generation int, event NotificationEvent, eventFile string, attempt int) {
+	if time.Since(p.started) >= e.service.Restart.MaxBackoff {
+		attempt = 0
+	}
+	attempt++
+
+	delay := e.service.Restart.Backoff(attempt)
+	e.logger.Warn("service exited, restarting", F(FieldWatcher, e.name), F(FieldError, p.err), F("restart", attempt), F("delay", delay))
+	time.Sleep(delay)
+
+	e.lock.Lock()
+	crashed := e.crashed
+	replaced := e.generation != generation
+	if crashed != nil && !replaced {
+		e.restarts = attempt
+	}
+	e.lock.Unlock()
+
+	if crashed != nil {
+		if replaced {
+			e.logger.Debug("service replaced, not restarted", F(FieldWatcher, e.name))
+		} else {
+			crashed(event, eventFile)
+		}
+		return
+	}
+
+	next, err := e.start(generation, event, eventFile, attempt)
+	if err != nil {
+		e.logger.Debug("service not restarted", F(FieldWatcher, e.name), F(FieldError, err))
+		return
+	}
+
+	if err := e.waitReady(next); err != nil {
+		e.logger.Warn("service restarted but not ready", F(FieldWatcher, e.name), F(FieldError, err))
+	} else {
+		e.logger.Info("service restarted and ready", F(FieldWatcher, e.name))
+	}
+}
+
+// stop the process gracefully, it is killed after the kill grace delay.
+func (e *serviceExec) stop(p *serviceProcess) {
+	e.lock.Lock()
+	p.stopping = true
+	e.lock.Unlock()
+
+	select {
+	case <-p.exited:
+		return
+	default:
+	}
+
+	grace := e.opts.KillGrace
+	if grace <= 0 {
+		grace = DefaultKillGrace
+	}
+
+	_ = terminateProcessGroup(p.cmd)
+
+	select {
+	case <-p.exited:
+	case <-time.After(grace):
+		_ = killProcessGroup(p.cmd)
+		<-p.exited
+	}
+}
+
+// waitReady returns once the probes succeed, or an error if the process
+// exited or is not ready before the timeout.
+func (e *serviceExec) waitReady(p *serviceProcess) error {
+	timeout := time.NewTimer(e.service.ReadyTimeout)
+	defer timeout.Stop()
+
+	probe := time.NewTicker(time.Millisecond * 100)
+	defer probe.Stop()
+
+	ready := p.ready
+	outputReady := e.service.ReadyOutput == nil
+	for {
+		if outputReady && e.probe() {
+			return nil
+		}
+
+		select {
+		case <-p.exited:
+			return fmt.Errorf("service exited before being ready: %v", p.err)
+		case <-timeout.C:
+			return fmt.Errorf("service not ready: %w after %s", ErrTimeout, e.service.ReadyTimeout)
+		case <-ready:
+			outputReady = true
+			ready = nil
+		case <-probe.C:
+		}
+	}
+}
+
+// probe returns true when the TCP and HTTP probes, if any, succeed.
+func (e *serviceExec) probe() bool {
+	if e.service.ReadyTCP != "" {
+		conn, err := net.DialTimeout("tcp", e.service.ReadyTCP, time.Second)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+	}
+
+	if e.service.ReadyHTTP != "" {
+		client := http.Client{Timeout: time.Second}
+		resp, err := client.Get(e.service.ReadyHTTP)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// readyWriter marks the process ready when a line matches.
+type readyWriter struct {
+	p  *serviceProcess
+	re *regexp.Regexp
+}
+
+func (w readyWriter) Write(b []byte) (int, error) {
+	if w.re != nil && w.re.Match(bytes.TrimRight(StripANSI(b), "\r\n")) {
+		w.p.readyOnce.Do(func() { close(w.p.ready) })
+	}
+	return len(b), nil
+}
@@ -0,0 +1,176 @@
+package pkg_test
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Leryan/watchngo/pkg"
+)
+
+// syncBuffer is written by both output streams of a service.
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+func TestServiceReadyOutput(t *testing.T) {
+	out := &syncBuffer{}
+
+	exec, err := pkg.NewExecutorService("web", out, "echo starting %event.file; sleep 0.2; echo listening >&2; sleep 2", pkg.ExecOptions{ErrOutput: out}, pkg.ServiceOptions{
+		ReadyOutput: regexp.MustCompile(`^listening$`),
+		Restart:     pkg.RetryPolicy{MinBackoff: time.Hour, MaxBackoff: time.Hour},
+	}, pkg.SilentLogger{})
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() { done <- exec.Exec(pkg.NotificationEvent{}, "first") }()
+
+	time.Sleep(time.Millisecond * 100)
+	require.True(t, exec.Running(), "starting")
+	require.NoError(t, <-done)
+	require.False(t, exec.Running(), "events are handled while the service runs")
+	require.Equal(t, "starting first\nlistening\n", out.String())
+
+	start := time.Now()
+	require.NoError(t, exec.Exec(pkg.NotificationEvent{}, "second"))
+	require.Less(t, int64(time.Since(start)), int64(time.Second), "previous process stopped")
+	require.Equal(t, "starting first\nlistening\nstarting second\nlistening\n", out.String())
+}
+
+func TestServiceRestart(t *testing.T) {
+	out := &syncBuffer{}
+	marker := filepath.Join(t.TempDir(), "crashed")
+
+	exec, err := pkg.NewExecutorService("web", out, "test -f "+marker+" || { touch "+marker+"; exit 1; }; echo up; sleep 2", pkg.ExecOptions{}, pkg.ServiceOptions{
+		Restart: pkg.RetryPolicy{MinBackoff: time.Millisecond * 50, MaxBackoff: time.Second},
+	}, pkg.SilentLogger{})
+	require.NoError(t, err)
+
+	require.NoError(t, exec.Exec(pkg.NotificationEvent{}, "none"), "ready without probes")
+	require.Eventually(t, func() bool { return out.String() == "up\n" }, time.Second, time.Millisecond*10, "restarted after crash")
+}
+
+func TestServiceReadyProbes(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	options := pkg.ServiceOptions{
+		ReadyTCP: addr,
+		Restart:  pkg.RetryPolicy{MinBackoff: time.Hour, MaxBackoff: time.Hour},
+	}
+
+	exec, err := pkg.NewExecutorService("web", &syncBuffer{}, "exit 2", pkg.ExecOptions{}, options, pkg.SilentLogger{})
+	require.NoError(t, err)
+	err = exec.Exec(pkg.NotificationEvent{}, "none")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "exited before being ready")
+
+	exec, err = pkg.NewExecutorService("web", &syncBuffer{}, "sleep 2", pkg.ExecOptions{}, options, pkg.SilentLogger{})
+	require.NoError(t, err)
+
+	go func() {
+		time.Sleep(time.Millisecond * 200)
+		if l, err := net.Listen("tcp", addr); err == nil {
+			time.Sleep(time.Second)
+			l.Close()
+		}
+	}()
+
+	start := time.Now()
+	require.NoError(t, exec.Exec(pkg.NotificationEvent{}, "none"))
+	require.GreaterOrEqual(t, int64(time.Since(start)), int64(time.Millisecond*200), "waited for the port")
+
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unhealthy.Close()
+
+	exec, err = pkg.NewExecutorService("web", &syncBuffer{}, "sleep 2", pkg.ExecOptions{}, pkg.ServiceOptions{
+		ReadyHTTP:    unhealthy.URL,
+		ReadyTimeout: time.Millisecond * 300,
+		Restart:      options.Restart,
+	}, pkg.SilentLogger{})
+	require.NoError(t, err)
+	err = exec.Exec(pkg.NotificationEvent{}, "none")
+	require.True(t, errors.Is(err, pkg.ErrTimeout), "not ready: %v", err)
+}
+
+func TestServiceConf(t *testing.T) {
+	watchers, err := watchersFromString(t, `
+[web]
+mode = service
+ready_http = http://127.0.0.1:8080/health
+ready_timeout = 1m
+command = go run ./cmd/web
+`)
+	require.NoError(t, err)
+	require.Equal(t, pkg.ModeService, watchers[0].Mode)
+
+	for _, conf := range []string{
+		"[web]\nmode = daemon\ncommand = true\n",
+		"[web]\nmode = service\nstep.1 = true\n",
+		"[web]\nmode = service\nexecutor = stdout\ncommand = true\n",
+		"[web]\nmode = service\noutput = on-failure\ncommand = true\n",
+		"[web]\nmode = service\nready_output = (\ncommand = true\n",
+	} {
+		_, err := watchersFromString(t, conf)
+		require.Error(t, err, strings.Split(conf, "\n")[1:3])
+	}
+}
+
+func TestServiceRestartReported(t *testing.T) {
+	workdir := t.TempDir()
+
+	watchers, err := watchersFromString(t, `
+workdir = `+workdir+`
+silent = true
+retry_backoff = 50ms..1s
+
+[web]
+match = `+t.TempDir()+`
+mode = service
+command = test -f crashed && sleep 5 || touch crashed
+on_success = echo ready >> ready
+`)
+	require.NoError(t, err)
+
+	w := watchers[0]
+	go w.Work()
+	defer w.Stop()
+
+	require.Eventually(t, func() bool {
+		last := w.State().LastRun
+		return last != nil && last.Cause == pkg.CauseRestart
+	}, time.Second*5, time.Millisecond*10, "restart recorded as a run")
+	require.Empty(t, w.State().LastRun.Error)
+
+	ready, err := os.ReadFile(filepath.Join(workdir, "ready"))
+	require.NoError(t, err)
+	require.Equal(t, "ready\nready\n", string(ready), "hooks run after the start and the restart")
+}
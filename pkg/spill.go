@@ -0,0 +1,115 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Default limits of a SpillBuffer.
+const (
+	DefaultSpillMemLimit = 1 << 20
+	DefaultSpillMaxSize  = 64 << 20
+)
+
+// SpillBuffer keeps written data in memory up to MemLimit bytes, then in a
+// temporary file up to MaxSize bytes. Data written past MaxSize is dropped
+// and counted. Close must be called to remove the temporary file.
+type SpillBuffer struct {
+	MemLimit int
+	MaxSize  int64
+	mem      bytes.Buffer
+	file     *os.File
+	size     int64
+	dropped  int64
+}
+
+func NewSpillBuffer() *SpillBuffer {
+	return &SpillBuffer{MemLimit: DefaultSpillMemLimit, MaxSize: DefaultSpillMaxSize}
+}
+
+// Write never returns an error, data that cannot be kept is dropped.
+func (b *SpillBuffer) Write(p []byte) (int, error) {
+	if b.size+int64(len(p)) > b.MaxSize {
+		b.dropped += int64(len(p))
+		return len(p), nil
+	}
+
+	if b.file == nil && b.mem.Len()+len(p) > b.MemLimit {
+		fh, err := ioutil.TempFile("", "watchngo-spill-*")
+		if err != nil {
+			b.dropped += int64(len(p))
+			return len(p), nil
+		}
+		b.file = fh
+	}
+
+	var err error
+	if b.file != nil {
+		_, err = b.file.Write(p)
+	} else {
+		_, err = b.mem.Write(p)
+	}
+
+	if err != nil {
+		b.dropped += int64(len(p))
+	} else {
+		b.size += int64(len(p))
+	}
+
+	return len(p), nil
+}
+
+// Dropped returns the number of bytes that could not be kept.
+func (b *SpillBuffer) Dropped() int64 {
+	return b.dropped
+}
+
+// Reader returns the kept data, from the beginning.
+func (b *SpillBuffer) Reader() (io.Reader, error) {
+	if b.file == nil {
+		return bytes.NewReader(b.mem.Bytes()), nil
+	}
+
+	if _, err := b.file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("spill buffer: %w", err)
+	}
+
+	return io.MultiReader(bytes.NewReader(b.mem.Bytes()), b.file), nil
+}
+
+// Close removes the temporary file, if any.
+func (b *SpillBuffer) Close() error {
+	b.mem.Reset()
+
+	if b.file == nil {
+		return nil
+	}
+
+	b.file.Close()
+	err := os.Remove(b.file.Name())
+	b.file = nil
+
+	return err
+}
+
+// spilledLines reads the kept data as lines, without line endings.
+func spilledLines(b *SpillBuffer) ([]string, error) {
+	r, err := b.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	return lines, scanner.Err()
+}
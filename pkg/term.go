@@ -0,0 +1,11 @@
+package pkg
+
+import "os"
+
+// IsTerminal returns true if f is a terminal. /dev/null is not one, so
+// commands run by a service manager get no colors nor escape sequences.
+// Outside of Linux and the BSDs any character device is taken for a
+// terminal, including the null device.
+func IsTerminal(f *os.File) bool {
+	return isTerminal(f)
+}
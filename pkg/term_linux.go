@@ -0,0 +1,157 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// terminalPoll is how often TerminalInput checks it is in the foreground.
+const terminalPoll = time.Millisecond * 200
+
+// isTerminal asks the terminal for its mode, which only terminals have.
+func isTerminal(f *os.File) bool {
+	var termios syscall.Termios
+	return ioctl(f, syscall.TCGETS, unsafe.Pointer(&termios)) == nil
+}
+
+// TerminalInput reads keys from a terminal in cbreak mode: as soon as they
+// are typed, and without echoing them. Signals like Ctrl-C and output
+// processing are kept, so commands output is not changed.
+//
+// Keys are only read while watchngo is in the foreground, so the shell keeps
+// its input once watchngo is put in the background, and cbreak mode is set
+// again when it comes back.
+type TerminalInput struct {
+	f     *os.File
+	saved syscall.Termios
+	cont  chan os.Signal
+
+	lock   sync.Mutex
+	cbreak bool
+	closed bool
+}
+
+// NewTerminalInput returns an error if f is not a terminal.
+func NewTerminalInput(f *os.File) (*TerminalInput, error) {
+	t := &TerminalInput{f: f, cont: make(chan os.Signal, 1)}
+	if err := ioctl(f, syscall.TCGETS, unsafe.Pointer(&t.saved)); err != nil {
+		return nil, fmt.Errorf("terminal input: %w", err)
+	}
+
+	// the shell restores its own mode while watchngo is stopped.
+	signal.Notify(t.cont, syscall.SIGCONT)
+
+	return t, nil
+}
+
+// foreground returns true when the process group of watchngo is the one
+// the terminal reads to.
+func (t *TerminalInput) foreground() bool {
+	var pgrp int32
+	if err := ioctl(t.f, syscall.TIOCGPGRP, unsafe.Pointer(&pgrp)); err != nil {
+		return false
+	}
+	return int(pgrp) == syscall.Getpgrp()
+}
+
+// setCbreak sets cbreak mode when in the foreground, and returns whether
+// keys can be read.
+func (t *TerminalInput) setCbreak() (bool, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.closed {
+		return false, io.EOF
+	}
+
+	select {
+	case <-t.cont:
+		t.cbreak = false
+	default:
+	}
+
+	if !t.foreground() {
+		t.cbreak = false
+		return false, nil
+	}
+
+	if t.cbreak {
+		return true, nil
+	}
+
+	termios := t.saved
+	termios.Lflag &^= syscall.ICANON | syscall.ECHO
+	termios.Cc[syscall.VMIN] = 1
+	termios.Cc[syscall.VTIME] = 0
+	if err := ioctl(t.f, syscall.TCSETS, unsafe.Pointer(&termios)); err != nil {
+		return false, fmt.Errorf("terminal input: %w", err)
+	}
+
+	t.cbreak = true
+	return true, nil
+}
+
+// readable waits up to timeout for keys.
+func (t *TerminalInput) readable(timeout time.Duration) (bool, error) {
+	fd := int(t.f.Fd())
+
+	var set syscall.FdSet
+	bits := int(8 * unsafe.Sizeof(set.Bits[0]))
+	set.Bits[fd/bits] |= 1 << uint(fd%bits)
+
+	tv := syscall.NsecToTimeval(timeout.Nanoseconds())
+	n, err := syscall.Select(fd+1, &set, nil, nil, &tv)
+	if errors.Is(err, syscall.EINTR) {
+		return false, nil
+	}
+	return n > 0, err
+}
+
+// Read blocks until keys are typed, and returns io.EOF once closed.
+func (t *TerminalInput) Read(p []byte) (int, error) {
+	for {
+		ok, err := t.setCbreak()
+		if err != nil {
+			return 0, err
+		}
+
+		if !ok {
+			time.Sleep(terminalPoll)
+			continue
+		}
+
+		if ready, err := t.readable(terminalPoll); err != nil {
+			return 0, fmt.Errorf("terminal input: %w", err)
+		} else if ready {
+			return t.f.Read(p)
+		}
+	}
+}
+
+// Close restores the mode of the terminal, Read returns io.EOF after.
+func (t *TerminalInput) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	signal.Stop(t.cont)
+
+	if !t.cbreak || !t.foreground() {
+		return nil
+	}
+
+	if err := ioctl(t.f, syscall.TCSETS, unsafe.Pointer(&t.saved)); err != nil {
+		return fmt.Errorf("terminal input: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package pkg
+
+import (
+	"errors"
+	"os"
+)
+
+// TerminalInput reads keys typed in a terminal, only on Linux.
+type TerminalInput struct{}
+
+func NewTerminalInput(f *os.File) (*TerminalInput, error) {
+	return nil, errors.New("terminal input: only supported on Linux")
+}
+
+func (t *TerminalInput) Read(p []byte) (int, error) {
+	return 0, errors.New("terminal input: only supported on Linux")
+}
+
+func (t *TerminalInput) Close() error {
+	return nil
+}
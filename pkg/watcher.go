@@ -1,43 +1,613 @@
 package pkg
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
 
 // Watcher ...
 type Watcher struct {
-	Name       string
-	Finder     Finder
-	Filter     Filter
-	Logger     Logger
-	Executor   Executor
-	Notifier   Notifier
-	eLock      sync.RWMutex
+	Name     string
+	Finder   Finder
+	Filter   Filter
+	Logger   Logger
+	Executor Executor
+	Notifier Notifier
+	// Retry failed commands, the Breaker then counts failed runs and
+	// pauses the watcher once it opens.
+	Retry   RetryPolicy
+	Breaker Breaker
+	// Mode is ModeCommand or ModeService, services are started by Work.
+	Mode string
+	// Hooks are run around the command. Output receives the command output,
+	// it can be nil if neither hooks nor the OutputFile need it.
+	Hooks      Hooks
+	Output     *RunOutput
+	OutputMode string
+	// LogOutput can be nil, it logs the output and is flushed after each run.
+	LogOutput  *LogWriter
+	OutputFile *OutputFile
+	// Problems can be nil, it collects diagnostics from the output.
+	Problems *Problems
+	// previousOutput holds the lines of the last run in OutputDiff mode.
+	previousOutput []string
+	// Presenter can be nil, when the output is not a terminal.
+	Presenter *Presenter
+	// History can be nil, it records runs and the state of the watcher.
+	History *History
+	// Events can be nil, it receives file changes, runs and their output.
+	Events *EventBus
+	// Metrics can be nil, it counts events and runs.
+	Metrics *Metrics
+	// Ignore holds absolute paths of files and directories written by
+	// watchngo, their changes never run the command.
+	Ignore []string
+	// After holds the watchers that must be idle and successful before
+	// this one runs. Triggers holds the watchers run after a success.
+	After    []*Watcher
+	Triggers []*Watcher
+	eLock    sync.RWMutex
+	// idle is signaled when pending or running change.
+	idle   *sync.Cond
+	paused bool
+	// pending counts events queued by Work and not handled yet.
+	pending   int
+	running   bool
+	lastErr   error
+	lastStart time.Time
+	lastRun   *RunRecord
+	// locations counts the locations added to the notifier.
+	locations  int
 	eventQueue chan NotificationEvent
+	triggers   chan triggerEvent
+	// stop is closed by Stop.
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
-func (w *Watcher) exec(event NotificationEvent, eventFile string) {
-	w.Logger.Log("running command on watcher \"%s\"", w.Name)
+// triggerEvent is sent by an upstream watcher after a successful run.
+type triggerEvent struct {
+	from      string
+	cause     string
+	event     NotificationEvent
+	eventFile string
+	date      time.Time
+}
+
+// run the command, retrying on failure. The output is written to the
+// OutputFile, and captured to a temporary file when a hook needs it, the
+// caller must remove it.
+func (w *Watcher) run(event NotificationEvent, eventFile string, fields []Field) RunResult {
+	var result RunResult
+
+	if w.Output != nil && w.Hooks.NeedsOutput() {
+		if fh, err := ioutil.TempFile("", "watchngo-*.log"); err != nil {
+			w.Logger.Error("cannot capture output", append(fields, F(FieldError, err))...)
+		} else {
+			defer fh.Close()
+			defer w.Output.Attach(fh)()
+			result.OutputFile = fh.Name()
+		}
+	}
+
+	if w.Output != nil && w.OutputFile != nil {
+		if fw, err := w.OutputFile.Start(w.Name, event, eventFile); err != nil {
+			w.Logger.Error("cannot write output file", append(fields, F(FieldError, err))...)
+		} else {
+			detach := w.Output.Attach(fw)
+			defer func() {
+				detach()
+				if err := w.OutputFile.Finish(result); err != nil {
+					w.Logger.Error("cannot write output file", append(fields, F(FieldError, err))...)
+				}
+			}()
+		}
+	}
+
+	if w.Output != nil && w.Problems != nil {
+		w.Problems.Start()
+		detach := w.Output.Attach(w.Problems)
+		defer func() {
+			detach()
+			if err := w.Problems.Finish(w.Name, result); err != nil {
+				w.Logger.Error("cannot write problems", append(fields, F(FieldError, err))...)
+			}
+		}()
+	}
+
+	start := time.Now()
 	err := w.Executor.Exec(event, eventFile)
 
+retries:
+	for retry := 1; err != nil && retry <= w.Retry.Retries; retry++ {
+		delay := w.Retry.Backoff(retry)
+		w.Logger.Warn("command failed, retrying", append(fields, F(FieldError, err), F("retry", fmt.Sprintf("%d/%d", retry, w.Retry.Retries)), F("delay", delay))...)
+
+		select {
+		case <-time.After(delay):
+		case <-w.stop:
+			break retries
+		}
+
+		err = w.Executor.Exec(event, eventFile)
+	}
+
+	result.Duration = time.Since(start)
+	result.ExitCode = ExitCode(err)
+	result.Err = err
+
+	return result
+}
+
+// holdOutput applies the output mode to a run, the returned function must
+// be called with its result.
+func (w *Watcher) holdOutput(fields []Field) func(result RunResult) {
+	if w.Output == nil {
+		return func(RunResult) {}
+	}
+
+	release := func(show bool) int {
+		lines, err := w.Output.Release(show)
+		if err != nil {
+			w.Logger.Error("cannot show output", append(fields, F(FieldError, err))...)
+		}
+		return lines
+	}
+
+	switch w.OutputMode {
+	case OutputOnFailure:
+		w.Output.Hold()
+
+		return func(result RunResult) {
+			lines := release(result.Err != nil)
+			if result.Err == nil {
+				fmt.Fprintf(w.Output.Stdout(), "%s: OK in %s, %d lines of output hidden\n", w.Name, result.Duration.Round(time.Millisecond), lines)
+			}
+		}
+	case OutputDiff:
+		current := NewSpillBuffer()
+		w.Output.Hold()
+		detach := w.Output.Attach(current)
+
+		return func(result RunResult) {
+			detach()
+			defer current.Close()
+
+			lines, err := spilledLines(current)
+			if err != nil {
+				w.Logger.Error("cannot read output", append(fields, F(FieldError, err))...)
+				release(true)
+				return
+			}
+
+			previous := w.previousOutput
+			w.previousOutput = lines
+
+			if previous == nil {
+				release(true)
+				return
+			}
+
+			release(false)
+
+			diff, added, removed, ok := LineDiff(previous, lines, DiffContext)
+			switch {
+			case !ok:
+				fmt.Fprintf(w.Output.Stdout(), "%s: output entirely changed, %d lines\n", w.Name, len(lines))
+			case diff == "":
+				fmt.Fprintf(w.Output.Stdout(), "%s: output unchanged, %d lines\n", w.Name, len(lines))
+			default:
+				fmt.Fprintf(w.Output.Stdout(), "--- %s: previous run\n+++ %s: this run\n%s%s: %d lines added, %d lines removed\n", w.Name, w.Name, diff, w.Name, added, removed)
+			}
+		}
+	default:
+		return func(RunResult) {}
+	}
+}
+
+// tryStart marks the watcher running, or returns ErrRunning if it already
+// is. exec must then be called.
+func (w *Watcher) tryStart() error {
+	w.eLock.Lock()
+	defer w.eLock.Unlock()
+
+	if w.running {
+		return fmt.Errorf("watcher %s: %w", w.Name, ErrRunning)
+	}
+
+	w.running = true
+	w.lastStart = time.Now()
+	return nil
+}
+
+// isRunning returns true from tryStart until the run finished, retries
+// included.
+func (w *Watcher) isRunning() bool {
+	w.eLock.RLock()
+	defer w.eLock.RUnlock()
+	return w.running
+}
+
+// exec runs the command for the events, the first one is given to the
+// command, once tryStart succeeded. cause is one of the Cause constants,
+// received is the date the first file change was received, if any.
+func (w *Watcher) exec(event NotificationEvent, eventFile string, cause string, events []RunEvent, received time.Time) error {
+	record := RunRecord{ID: nextRunID(), Watcher: w.Name, Cause: cause, Events: events}
+	fields := []Field{F(FieldWatcher, w.Name), F(FieldRunID, record.ID), F(FieldPath, eventFile), F(FieldOp, event.Notification)}
+
+	w.eLock.RLock()
+	record.Start = w.lastStart
+	w.eLock.RUnlock()
+
+	if w.Metrics != nil && !received.IsZero() {
+		w.Metrics.eventToExec(w.Name, record.Start.Sub(received))
+	}
+
+	w.stateChanged(fields)
+	started := record
+	w.publish(BusEvent{Type: BusEventRunStart, Run: &started, RunID: record.ID})
+
+	var excerpt *tailBuffer
+	if w.History != nil && w.Output != nil {
+		excerpt = newTailBuffer(HistoryOutputLines)
+		defer w.Output.Attach(excerpt)()
+	}
+
+	var lines *busWriter
+	if w.Events != nil && w.Output != nil {
+		lines = &busWriter{bus: w.Events, watcher: w.Name, runID: record.ID}
+		defer w.Output.Attach(lines)()
+	}
+
+	if w.Presenter != nil {
+		w.Presenter.Start(w.Name, event, eventFile)
+	}
+
+	if w.Mode == ModeService {
+		w.Logger.Info("starting service", fields...)
+	} else {
+		w.Logger.Info("running command", fields...)
+	}
+
+	if err := w.Hooks.Start(event, eventFile); err != nil {
+		w.Logger.Warn("on_start hook failed", append(fields, F(FieldError, err))...)
+	}
+
+	finishOutput := w.holdOutput(fields)
+
+	result := w.run(event, eventFile, fields)
+	if result.OutputFile != "" {
+		defer os.Remove(result.OutputFile)
+	}
+
+	finishOutput(result)
+
+	if lines != nil {
+		lines.Flush()
+	}
+
+	if w.LogOutput != nil {
+		w.LogOutput.Flush()
+	}
+
+	err := result.Err
+	record.Duration = result.Duration
+	record.ExitCode = result.ExitCode
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if excerpt != nil {
+		record.Output = string(StripANSI([]byte(excerpt.String())))
+	}
+	resultFields := append(fields[:len(fields):len(fields)], F(FieldDuration, result.Duration.Round(time.Millisecond)), F(FieldExitCode, result.ExitCode))
+	if err != nil {
+		resultFields = append(resultFields, F(FieldError, err))
+	}
+
+	outcome := OutcomeFailure
 	if err == nil {
-		w.Logger.Log("finished running command on watcher \"%s\"", w.Name)
+		outcome = OutcomeSuccess
+	} else if errors.Is(err, ErrTimeout) || errors.As(err, new(*LimitError)) {
+		outcome = OutcomeKilled
+	}
+
+	if w.Metrics != nil {
+		w.Metrics.runFinished(w.Name, outcome, result.Duration)
+	}
+
+	if w.Mode == ModeService {
+		if err == nil {
+			w.Logger.Info("service ready", resultFields...)
+		} else {
+			w.Logger.Warn("service not ready", resultFields...)
+		}
+	} else if outcome == OutcomeSuccess {
+		w.Logger.Info("finished running command", resultFields...)
+	} else if outcome == OutcomeKilled {
+		w.Logger.Warn("killed command", resultFields...)
 	} else {
-		w.Logger.Log("finished running command on watcher \"%s\" with error: %v", w.Name, err)
+		w.Logger.Warn("command failed", resultFields...)
+	}
+
+	if w.Presenter != nil {
+		w.Presenter.Finish(w.Name, result)
+	}
+
+	if err := w.Hooks.Finish(event, eventFile, result); err != nil {
+		w.Logger.Warn("hook failed", append(fields, F(FieldError, err))...)
+	}
+
+	// downstream watchers are triggered before this one becomes idle, so
+	// the ones waiting for it can tell the trigger is already satisfied.
+	if err == nil {
+		for _, downstream := range w.Triggers {
+			w.Logger.Info("triggering watcher", append(fields, F("downstream", downstream.Name))...)
+			downstream.trigger(triggerEvent{from: w.Name, cause: CauseWatcher + w.Name, event: event, eventFile: eventFile, date: time.Now()})
+		}
+	}
+
+	defer w.finishRun(record, fields)
+
+	w.eLock.Lock()
+	defer w.eLock.Unlock()
+
+	w.running = false
+	w.lastErr = err
+	w.lastRun = &record
+	w.idle.Broadcast()
+
+	wasOpen := w.Breaker.Open()
+
+	switch open := w.Breaker.Record(err); {
+	case open:
+		w.paused = true
+		w.Logger.Warn("paused watcher: breaker opened", F(FieldWatcher, w.Name), F("failures", w.Breaker.Failures()))
+	case wasOpen:
+		w.paused = false
+		w.Logger.Info("resumed watcher: breaker reset after a successful run", F(FieldWatcher, w.Name))
+	case err != nil && w.Breaker.Threshold > 0:
+		w.Logger.Info("command failed, counting consecutive failures until the breaker opens", F(FieldWatcher, w.Name), F("consecutive_failures", w.Breaker.Failures()), F("threshold", w.Breaker.Threshold))
+	}
+
+	return err
+}
+
+// finishRun records the run in the History and publishes it, once the
+// watcher is idle.
+func (w *Watcher) finishRun(record RunRecord, fields []Field) {
+	w.publish(BusEvent{Type: BusEventRunFinish, Run: &record, RunID: record.ID})
+	w.publish(BusEvent{Type: BusEventState, State: w.State().State})
+
+	if w.History == nil {
+		return
+	}
+
+	if err := w.History.Append(record); err != nil {
+		w.Logger.Error("cannot record run", append(fields, F(FieldError, err))...)
+	}
+}
+
+// stateChanged updates the status file and publishes the new state.
+func (w *Watcher) stateChanged(fields []Field) {
+	w.publish(BusEvent{Type: BusEventState, State: w.State().State})
+
+	if w.History == nil {
+		return
+	}
+
+	if err := w.History.WriteStatus(); err != nil {
+		w.Logger.Error("cannot write status", append(fields, F(FieldError, err))...)
+	}
+}
+
+// publish the event to the Events bus, if any.
+func (w *Watcher) publish(event BusEvent) {
+	if w.Events != nil {
+		event.Watcher = w.Name
+		w.Events.Publish(event)
+	}
+}
+
+// trigger queues a run, replacing any queued one.
+func (w *Watcher) trigger(t triggerEvent) {
+	for {
+		select {
+		case w.triggers <- t:
+			return
+		default:
+			select {
+			case <-w.triggers:
+			default:
+			}
+		}
+	}
+}
+
+// addPending counts events queued, with a positive delta, or handled.
+func (w *Watcher) addPending(delta int) {
+	w.eLock.Lock()
+	was := w.pending > 0
+	w.pending += delta
+	changed := was != (w.pending > 0)
+	w.idle.Broadcast()
+	w.eLock.Unlock()
+
+	if changed {
+		w.stateChanged([]Field{F(FieldWatcher, w.Name)})
+	}
+}
+
+// waitIdle blocks until the watcher has neither pending events nor a
+// running command, then returns the error of its last run.
+func (w *Watcher) waitIdle() error {
+	w.eLock.Lock()
+	defer w.eLock.Unlock()
+
+	for w.pending > 0 || w.running {
+		w.idle.Wait()
+	}
+
+	return w.lastErr
+}
+
+// execAfter runs the command once the watchers in After are idle, only if
+// their last run succeeded.
+func (w *Watcher) execAfter(event NotificationEvent, eventFile string, cause string, events []RunEvent, received time.Time) {
+	for _, upstream := range w.After {
+		if err := upstream.waitIdle(); err != nil {
+			w.Logger.Warn("skipped command: upstream watcher failed", F(FieldWatcher, w.Name), F("upstream", upstream.Name), F(FieldError, err))
+			return
+		}
+	}
+
+	w.execNow(event, eventFile, cause, events, received)
+}
+
+// execNow runs the command unless the watcher is already running, a manual
+// trigger for instance.
+func (w *Watcher) execNow(event NotificationEvent, eventFile string, cause string, events []RunEvent, received time.Time) {
+	if err := w.tryStart(); err != nil {
+		w.Logger.Debug("already running, skipped command", F(FieldWatcher, w.Name), F(FieldError, err))
+		return
+	}
+
+	w.exec(event, eventFile, cause, events, received)
+}
+
+// ErrRunning is returned when triggering a watcher already running.
+var ErrRunning = errors.New("already running")
+
+// Trigger runs the command now as if the paths were written, even if the
+// watcher is paused. The first path is given to the command. A successful
+// run resets the breaker. ErrRunning is returned if the watcher is running.
+func (w *Watcher) Trigger(paths ...string) error {
+	if err := w.tryStart(); err != nil {
+		return err
+	}
+
+	return w.triggerStarted(paths...)
+}
+
+// triggerStarted is Trigger once tryStart succeeded.
+func (w *Watcher) triggerStarted(paths ...string) error {
+	eventFile := ""
+	if len(paths) > 0 {
+		eventFile = paths[0]
+	}
+
+	event := NotificationEvent{
+		Path:         eventFile,
+		Notification: NotificationWrite,
+		FileType:     FileTypeFile,
+	}
+
+	events := make([]RunEvent, 0, len(paths))
+	for _, path := range paths {
+		events = append(events, RunEvent{Path: path, Op: event.Notification.String()})
+	}
+
+	return w.exec(event, eventFile, CauseManual, events, time.Time{})
+}
+
+// Paused returns true when events are ignored by the watcher.
+func (w *Watcher) Paused() bool {
+	w.eLock.RLock()
+	defer w.eLock.RUnlock()
+	return w.paused
+}
+
+// Pause the watcher, file changes are ignored until it is resumed.
+func (w *Watcher) Pause() {
+	w.eLock.Lock()
+	w.paused = true
+	w.eLock.Unlock()
+
+	w.stateChanged([]Field{F(FieldWatcher, w.Name)})
+}
+
+// Resume the watcher and reset its breaker.
+func (w *Watcher) Resume() {
+	w.eLock.Lock()
+	w.paused = false
+	w.Breaker.Reset()
+	w.eLock.Unlock()
+
+	w.stateChanged([]Field{F(FieldWatcher, w.Name)})
+}
+
+// Watcher states.
+const (
+	StateIdle       = "idle"
+	StateDebouncing = "debouncing"
+	StateRunning    = "running"
+	StateFailed     = "failed"
+	StatePaused     = "paused"
+)
+
+// WatcherState is a snapshot of the state of a watcher.
+type WatcherState struct {
+	// State is one of the State constants, a paused watcher may still be
+	// running a manually triggered command.
+	State string
+	// RunningSince is set while running.
+	RunningSince time.Time
+	// LastRun is nil until a run finished.
+	LastRun *RunRecord
+	// Locations is the number of files and directories watched.
+	Locations int
+}
+
+// State returns the current state of the watcher.
+func (w *Watcher) State() WatcherState {
+	w.eLock.RLock()
+	defer w.eLock.RUnlock()
+
+	state := WatcherState{State: StateIdle, LastRun: w.lastRun, Locations: w.locations}
+
+	switch {
+	case w.running:
+		state.State = StateRunning
+		state.RunningSince = w.lastStart
+	case w.paused:
+		state.State = StatePaused
+	case w.pending > 0:
+		state.State = StateDebouncing
+	case w.lastErr != nil:
+		state.State = StateFailed
 	}
+
+	return state
 }
 
+// handleFSEvent tells whether the event must run the command, the decision
+// is published to the Events bus.
 func (w *Watcher) handleFSEvent(event NotificationEvent, eventFile string) bool {
-	w.Logger.Debug("event: %v", event)
+	w.Logger.Trace("event", F(FieldWatcher, w.Name), F(FieldPath, event.Path), F(FieldOp, event.Notification))
 
 	if eventFile == "" {
 		return false
 	}
 
+	reason := w.rejectFSEvent(event, eventFile)
+	w.publish(BusEvent{Type: BusEventFS, Path: eventFile, Op: event.Notification.String(), Accepted: reason == "", Reason: reason})
+	if w.Metrics != nil && reason != "" {
+		w.Metrics.eventRejected(w.Name, event.Notification, reason)
+	}
+
+	return reason == ""
+}
+
+// rejectFSEvent returns why the event must not run the command, or an empty
+// string.
+func (w *Watcher) rejectFSEvent(event NotificationEvent, eventFile string) string {
 	if !w.Filter.MatchString(eventFile) {
-		return false
+		return RejectFilter
 	}
 
 	isWrite := NotificationWrite&event.Notification == NotificationWrite
@@ -47,29 +617,58 @@ func (w *Watcher) handleFSEvent(event NotificationEvent, eventFile string) bool
 	isRename := NotificationRename&event.Notification == NotificationRename
 
 	if event.Error != nil && !isRemove && !isRename {
-		w.Logger.Log("worker: %s: %v", eventFile, event.Error)
-		return false
+		w.Logger.Error("event error", F(FieldWatcher, w.Name), F(FieldPath, eventFile), F(FieldError, event.Error))
+		return RejectError
 	}
 
 	isFile := event.FileType == FileTypeFile
 	isDir := event.FileType == FileTypeDir
 
-	if w.Executor.Running() {
-		w.Logger.Debug("already running, ignoring")
-		return false
+	if w.Paused() {
+		w.Logger.Debug("paused, ignoring event", F(FieldWatcher, w.Name), F(FieldPath, eventFile))
+		return RejectPaused
+	}
+
+	if w.isRunning() {
+		w.Logger.Debug("already running, ignoring event", F(FieldWatcher, w.Name), F(FieldPath, eventFile))
+		return RejectRunning
 	}
 
-	mustExec := false
 	if (isWrite || isChmod || isCreate) && isFile {
-		mustExec = true
+		return ""
 	} else if isRemove || isRename {
 		_ = w.Notifier.Remove(eventFile)
-		mustExec = true
+		return ""
 	} else if isDir {
-		mustExec = true
+		return ""
 	}
 
-	return mustExec
+	return RejectOp
+}
+
+// ignored returns true for paths in Ignore or under them, and for the
+// temporary files used to replace them.
+func (w *Watcher) ignored(path string) bool {
+	if len(w.Ignore) == 0 || path == "" {
+		return false
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	for _, ignore := range w.Ignore {
+		if abs == ignore || strings.HasPrefix(abs, ignore+string(filepath.Separator)) {
+			return true
+		}
+
+		if filepath.Dir(abs) == filepath.Dir(ignore) && strings.HasPrefix(filepath.Base(abs), "."+filepath.Base(ignore)+".") {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (w *Watcher) eventQueueConsumer() {
@@ -77,24 +676,62 @@ func (w *Watcher) eventQueueConsumer() {
 	timer := time.NewTimer(timerInterval)
 	evtDate := time.Now()
 	events := make([]NotificationEvent, 0)
+	// received holds the date each event was received.
+	received := make([]time.Time, 0)
 
 	for {
 		select {
+		case <-w.stop:
+			// downstream watchers must not wait for them.
+			w.addPending(-len(events))
+			return
 		case event := <-w.eventQueue:
 			events = append(events, event)
 			evtDate = time.Now()
+			received = append(received, evtDate)
+		case t := <-w.triggers:
+			w.eLock.RLock()
+			ranSince := w.lastStart.After(t.date)
+			w.eLock.RUnlock()
+
+			if ranSince {
+				w.Logger.Debug("trigger already satisfied", F(FieldWatcher, w.Name), F("upstream", t.from))
+			} else if w.Paused() {
+				w.Logger.Debug("paused, ignoring trigger", F(FieldWatcher, w.Name), F("upstream", t.from))
+			} else {
+				var events []RunEvent
+				if t.eventFile != "" {
+					events = []RunEvent{{Path: t.eventFile, Op: t.event.Notification.String()}}
+				}
+				if t.cause == CauseRestart {
+					// a crashed service does not wait for its upstreams.
+					w.execNow(t.event, t.eventFile, t.cause, events, time.Time{})
+				} else {
+					w.execAfter(t.event, t.eventFile, t.cause, events, time.Time{})
+				}
+			}
 		case <-timer.C:
 			if time.Now().Sub(evtDate) > timerInterval && len(events) > 0 {
-				w.Logger.Debug("sending %d events", len(events))
-				w.Logger.Debug("events: %v", events)
-				executed := false
-				for _, event := range events {
-					if w.handleFSEvent(event, event.Path) && !executed {
-						w.exec(event, event.Path)
-						executed = true
+				w.Logger.Debug("handling events", F(FieldWatcher, w.Name), F("events", len(events)))
+				if w.Metrics != nil {
+					w.Metrics.batch(w.Name, len(events))
+				}
+				first := -1
+				accepted := make([]RunEvent, 0)
+				for i, event := range events {
+					if w.handleFSEvent(event, event.Path) {
+						if first < 0 {
+							first = i
+						}
+						accepted = append(accepted, RunEvent{Path: event.Path, Op: event.Notification.String()})
 					}
 				}
+				if first >= 0 {
+					w.execAfter(events[first], events[first].Path, CauseEvents, accepted, received[first])
+				}
+				w.addPending(-len(events))
 				events = make([]NotificationEvent, 0)
+				received = make([]time.Time, 0)
 				evtDate = time.Now()
 			}
 			timer.Reset(timerInterval)
@@ -110,36 +747,95 @@ func (w *Watcher) Work() error {
 	}
 
 	for _, location := range res.Locations {
-		w.Logger.Debug("add location %s", location)
+		w.Logger.Debug("add location", F(FieldWatcher, w.Name), F(FieldPath, location))
 		if err := w.Notifier.Add(location); err != nil {
 			return err
 		}
 	}
 
-	go w.eventQueueConsumer()
+	w.eLock.Lock()
+	w.locations = len(res.Locations)
+	w.eLock.Unlock()
+
+	consumed := make(chan struct{})
+	go func() {
+		w.eventQueueConsumer()
+		close(consumed)
+	}()
 	defer w.Notifier.Close()
-	defer func() { close(w.eventQueue) }()
+	defer func() { <-consumed }()
+
+	w.Logger.Info("running watcher", F(FieldWatcher, w.Name))
 
-	w.Logger.Log("running watcher \"%s\"", w.Name)
+	if service, ok := w.Executor.(interface {
+		OnCrash(func(NotificationEvent, string))
+	}); ok {
+		service.OnCrash(func(event NotificationEvent, eventFile string) {
+			w.trigger(triggerEvent{from: w.Name, cause: CauseRestart, event: event, eventFile: eventFile, date: time.Now()})
+		})
+	}
+
+	if w.Mode == ModeService {
+		w.trigger(triggerEvent{from: w.Name, cause: CauseStart, event: NotificationEvent{Notification: NotificationCreate, FileType: FileTypeFile}, date: time.Now()})
+	}
 
 	events := w.Notifier.Events()
 
 	for {
-		event := <-events
+		var event NotificationEvent
+		select {
+		case <-w.stop:
+			w.Logger.Info("stopped watcher", F(FieldWatcher, w.Name))
+			return nil
+		case e, ok := <-events:
+			if !ok {
+				return fmt.Errorf("watcher %s: notifier closed", w.Name)
+			}
+			event = e
+		}
 
-		w.Logger.Debug("pre-filtering event: %v", event)
+		w.Logger.Trace("pre-filtering event", F(FieldWatcher, w.Name), F(FieldPath, event.Path), F(FieldOp, event.Notification))
 
 		if event.Notification&NotificationError == NotificationError {
+			if w.Metrics != nil {
+				w.Metrics.notifierError(w.Name)
+			}
 			if event.Path == "" {
-				w.Logger.Log("watcher \"%s\" stopped: %v -> closed: %v", w.Name, event.Error, w.Notifier.Close())
+				fields := []Field{F(FieldWatcher, w.Name), F(FieldError, event.Error)}
+				if err := w.Notifier.Close(); err != nil {
+					fields = append(fields, F("close_error", err))
+				}
+				w.Logger.Error("watcher stopped", fields...)
 				return event.Error
 			}
+		} else if w.ignored(event.Path) {
+			w.Logger.Trace("ignored event", F(FieldWatcher, w.Name), F(FieldPath, event.Path))
 		} else {
-			w.eventQueue <- event
+			if w.Metrics != nil {
+				w.Metrics.eventReceived(w.Name, event.Notification)
+			}
+			// downstream watchers wait from now on, not once the event is
+			// dequeued.
+			w.addPending(1)
+			select {
+			case w.eventQueue <- event:
+			case <-w.stop:
+				w.addPending(-1)
+			}
 		}
 	}
 }
 
+// Stop the watcher and its service, if any. Work returns once the running
+// command, if any, is done.
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() { close(w.stop) })
+
+	if service, ok := w.Executor.(interface{ Stop() }); ok {
+		service.Stop()
+	}
+}
+
 func NewWatcher(name string, finder Finder, filter Filter, notifier Notifier, executor Executor, logger Logger) (*Watcher, error) {
 	if logger == nil {
 		return nil, fmt.Errorf("new watcher: logger cannot be nil")
@@ -169,7 +865,10 @@ func NewWatcher(name string, finder Finder, filter Filter, notifier Notifier, ex
 		Filter:     filter,
 		Finder:     finder,
 		eventQueue: make(chan NotificationEvent),
+		triggers:   make(chan triggerEvent, 1),
+		stop:       make(chan struct{}),
 	}
+	watcher.idle = sync.NewCond(&watcher.eLock)
 
 	return watcher, nil
 }
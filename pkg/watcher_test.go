@@ -1,6 +1,8 @@
 package pkg_test
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -51,8 +53,9 @@ type testCase struct {
 func (t *testWatcher) TestMatchFilterLogExecute() {
 	notifications := make(chan pkg.NotificationEvent, 1)
 
-	t.logger.EXPECT().Log(gomock.Any(), gomock.Any()).AnyTimes()
+	t.logger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
 	t.logger.EXPECT().Debug(gomock.Any(), gomock.Any()).AnyTimes()
+	t.logger.EXPECT().Trace(gomock.Any(), gomock.Any()).AnyTimes()
 
 	gomock.InOrder(
 		t.finder.EXPECT().Find().Return(&pkg.FinderResults{Locations: []string{"sub1/f1", "sub2/f1", "sub1/f2"}}, nil),
@@ -63,7 +66,6 @@ func (t *testWatcher) TestMatchFilterLogExecute() {
 		t.notifier.EXPECT().Events().Return(notifications),
 
 		t.filter.EXPECT().MatchString("sub1/f1").Return(true),
-		t.executor.EXPECT().Running().Return(false),
 		t.executor.EXPECT().Exec(gomock.Any(), "sub1/f1").Times(1),
 	)
 
@@ -79,3 +81,76 @@ func (t *testWatcher) TestMatchFilterLogExecute() {
 
 	time.Sleep(time.Millisecond * 500)
 }
+
+func (t *testWatcher) TestRetryBreaker() {
+	failure := fmt.Errorf("failure")
+
+	t.logger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	t.logger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	t.watcher.Retry = pkg.RetryPolicy{Retries: 1, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	t.watcher.Breaker.Threshold = 2
+
+	gomock.InOrder(
+		t.executor.EXPECT().Exec(gomock.Any(), "manual").Return(failure),
+		t.executor.EXPECT().Exec(gomock.Any(), "manual").Return(nil),
+	)
+	t.NoError(t.watcher.Trigger("manual"), "succeeds on retry")
+
+	t.executor.EXPECT().Exec(gomock.Any(), "manual").Return(failure).Times(4)
+	t.Error(t.watcher.Trigger("manual"))
+	t.False(t.watcher.Paused())
+	t.Error(t.watcher.Trigger("manual"))
+	t.True(t.watcher.Paused(), "breaker opened")
+
+	t.executor.EXPECT().Exec(gomock.Any(), "manual").Return(nil)
+	t.NoError(t.watcher.Trigger("manual"))
+	t.False(t.watcher.Paused(), "breaker reset")
+}
+
+func (t *testWatcher) TestStopDuringRetryBackoff() {
+	failure := fmt.Errorf("failure")
+
+	t.logger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	t.logger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	t.watcher.Retry = pkg.RetryPolicy{Retries: 1, MinBackoff: time.Minute, MaxBackoff: time.Minute}
+
+	t.executor.EXPECT().Exec(gomock.Any(), "manual").Return(failure)
+
+	done := make(chan error)
+	go func() { done <- t.watcher.Trigger("manual") }()
+	time.Sleep(time.Millisecond * 50)
+	t.watcher.Stop()
+
+	select {
+	case err := <-done:
+		t.True(errors.Is(err, failure), "last error kept")
+	case <-time.After(time.Second):
+		t.Fail("retry backoff not interrupted by Stop")
+	}
+}
+
+func (t *testWatcher) TestConcurrentTriggers() {
+	t.logger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	t.logger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	t.watcher.Retry = pkg.RetryPolicy{Retries: 1, MinBackoff: time.Millisecond * 200, MaxBackoff: time.Millisecond * 200}
+
+	gomock.InOrder(
+		t.executor.EXPECT().Exec(gomock.Any(), "manual").Return(fmt.Errorf("failure")),
+		t.executor.EXPECT().Exec(gomock.Any(), "manual").Return(nil),
+	)
+
+	done := make(chan error)
+	go func() { done <- t.watcher.Trigger("manual") }()
+	time.Sleep(time.Millisecond * 50)
+
+	// the watcher is still running while waiting to retry.
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		go func() { errs <- t.watcher.Trigger("manual") }()
+	}
+	for i := 0; i < cap(errs); i++ {
+		t.True(errors.Is(<-errs, pkg.ErrRunning))
+	}
+
+	t.NoError(<-done)
+}